@@ -4,10 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"strings"
 
 	"github.com/m5lapp/go-dive-diver-service/internal/data"
-	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
 	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
@@ -41,20 +39,9 @@ func (app *app) createAgencyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = app.models.Agencies.Insert(agency)
+	err = app.models.Agencies.Insert(r.Context(), agency)
 	if err != nil {
-		var errUniqConstraint *sqldb.ErrUniqueConstraintViolation
-		switch {
-		case errors.As(err, &errUniqConstraint):
-			e := make(map[string]string)
-			if len(errUniqConstraint.Columns) == 1 {
-				e[errUniqConstraint.Columns[0]] = "A record already eists for this value"
-			} else {
-				cols := strings.Join(errUniqConstraint.Columns, ", ")
-				e["form"] = fmt.Sprintf("A record already exists for the values %v", cols)
-			}
-			app.FailedValidationResponse(w, r, e)
-		default:
+		if !app.constraintViolationResponse(w, r, err) {
 			app.ServerErrorResponse(w, r, err)
 		}
 		return
@@ -76,7 +63,7 @@ func (app *app) fetchAgencyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	agency, err := app.models.Agencies.GetOneByID(id)
+	agency, err := app.models.Agencies.GetOneByID(r.Context(), id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -95,12 +82,130 @@ func (app *app) fetchAgencyHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *app) listAgenciesHandler(w http.ResponseWriter, r *http.Request) {
-	agencies, err := app.models.Agencies.GetAll()
+	qs := r.URL.Query()
+	v := validator.New()
+
+	acronym := app.ReadString(qs, "acronym", "")
+	filters := app.readFilters(qs, v, "common_name", "id", "common_name", "full_name", "acronym")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	agencies, metadata, err := app.models.Agencies.GetAll(r.Context(), acronym, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"agencies": agencies, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateAgencyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	agency, err := app.models.Agencies.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Make sure that nobody else has changed the agency since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, agency.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those.
+	var input struct {
+		CommonName *string `json:"common_name"`
+		FullName   *string `json:"full_name"`
+		Acronym    *string `json:"acronym"`
+		URL        *string `json:"url"`
+	}
+
+	err = jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.CommonName != nil {
+		agency.CommonName = *input.CommonName
+	}
+	if input.FullName != nil {
+		agency.FullName = *input.FullName
+	}
+	if input.Acronym != nil {
+		agency.Acronym = input.Acronym
+	}
+	if input.URL != nil {
+		agency.URL = input.URL
+	}
+
+	v := validator.New()
+
+	data.ValidateAgency(v, agency)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Agencies.Update(r.Context(), agency)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"agency": agency}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
+}
+
+func (app *app) deleteAgencyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Agencies.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
 
-	data := jsonz.Envelope{"agencies": agencies}
+	data := jsonz.Envelope{"message": "Agency successfully deleted"}
 	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
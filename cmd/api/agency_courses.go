@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// readAgencyCourseParams reads the agency ID and course ID URL parameters from
+// the request and checks that the course exists for the agency. If it does not,
+// or the parameters are invalid, an appropriate response will be sent and nil
+// will be returned.
+func (app *app) readAgencyCourseParams(w http.ResponseWriter, r *http.Request) *data.AgencyCourse {
+	agencyID, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	courseID, err := app.readNamedIDParam(r, "course_id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	course, err := app.models.AgencyCourses.GetOneByID(r.Context(), agencyID, courseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return course
+}
+
+func (app *app) createAgencyCourseHandler(w http.ResponseWriter, r *http.Request) {
+	agencyID, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name              string  `json:"name"`
+		URL               *string `json:"url"`
+		IsSpecialtyCourse bool    `json:"is_specialty_course"`
+		IsTechCourse      bool    `json:"is_tech_course"`
+		IsProCourse       bool    `json:"is_pro_course"`
+	}
+
+	err = jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	// Make sure that the agency exists before trying to add a course to it.
+	_, err = app.models.Agencies.GetOneByID(r.Context(), agencyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	course := &data.AgencyCourse{
+		AgencyID:          agencyID,
+		Name:              input.Name,
+		URL:               input.URL,
+		IsSpecialtyCourse: input.IsSpecialtyCourse,
+		IsTechCourse:      input.IsTechCourse,
+		IsProCourse:       input.IsProCourse,
+	}
+
+	v := validator.New()
+
+	data.ValidateAgencyCourse(v, course)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.AgencyCourses.Insert(r.Context(), course)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/agency/%d/course/%d", agencyID, course.ID))
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, headers, jsonz.Envelope{"course": course})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) fetchAgencyCourseHandler(w http.ResponseWriter, r *http.Request) {
+	course := app.readAgencyCourseParams(w, r)
+	if course == nil {
+		return
+	}
+
+	data := jsonz.Envelope{"course": course}
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listAgencyCoursesHandler(w http.ResponseWriter, r *http.Request) {
+	agencyID, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	filters := data.AgencyCourseFilters{
+		IsSpecialtyCourse: app.readBool(qs, "is_specialty_course", v),
+		IsTechCourse:      app.readBool(qs, "is_tech_course", v),
+		IsProCourse:       app.readBool(qs, "is_pro_course", v),
+	}
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Agencies.GetOneByID(r.Context(), agencyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	courses, err := app.models.AgencyCourses.GetAllForAgency(r.Context(), agencyID, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"courses": courses}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateAgencyCourseHandler(w http.ResponseWriter, r *http.Request) {
+	course := app.readAgencyCourseParams(w, r)
+	if course == nil {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those.
+	var input struct {
+		Name              *string `json:"name"`
+		URL               *string `json:"url"`
+		IsSpecialtyCourse *bool   `json:"is_specialty_course"`
+		IsTechCourse      *bool   `json:"is_tech_course"`
+		IsProCourse       *bool   `json:"is_pro_course"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		course.Name = *input.Name
+	}
+	if input.URL != nil {
+		course.URL = input.URL
+	}
+	if input.IsSpecialtyCourse != nil {
+		course.IsSpecialtyCourse = *input.IsSpecialtyCourse
+	}
+	if input.IsTechCourse != nil {
+		course.IsTechCourse = *input.IsTechCourse
+	}
+	if input.IsProCourse != nil {
+		course.IsProCourse = *input.IsProCourse
+	}
+
+	v := validator.New()
+
+	data.ValidateAgencyCourse(v, course)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.AgencyCourses.Update(r.Context(), course)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"course": course}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) deleteAgencyCourseHandler(w http.ResponseWriter, r *http.Request) {
+	agencyID, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	courseID, err := app.readNamedIDParam(r, "course_id")
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.AgencyCourses.Delete(r.Context(), agencyID, courseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Course successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
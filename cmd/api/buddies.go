@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bytes"
 	"errors"
-	"fmt"
 	"net/http"
-	"time"
+	"strings"
 
-	"github.com/julienschmidt/httprouter"
 	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
 	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
@@ -22,6 +20,9 @@ func (app *app) createBuddyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Buddies are always added to the authenticated diver's own list.
+	input.UserID = app.contextGetPrincipal(r).UserID
+
 	v := validator.New()
 	data.ValidateBuddy(v, input)
 	if !v.Valid() {
@@ -29,116 +30,424 @@ func (app *app) createBuddyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !app.linkBuddyUser(w, r, input) {
+		return
+	}
+
+	// If the buddy has an email address but is not a registered diver yet, an
+	// invitation is created along with them that they can redeem when they
+	// register so that they get linked back to this diver automatically.
+	inv, err := app.models.Buddies.Insert(r.Context(), input, app.cfg.invitationTTL)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.acceptMutualBuddyRequest(w, r, input) {
+		return
+	}
+
+	app.Logger.Info("New buddy successfully added", "user", input.UserID,
+		"buddy", input.Name, "account_linked", input.BuddyUserID != nil)
+
+	b := jsonz.Envelope{"buddy": input}
+	if inv != nil {
+		b["invitation"] = inv
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, nil, b)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// linkBuddyUser checks whether the given buddy's email address, if provided,
+// belongs to an active user account with a diver record. If it does, the
+// buddy's BuddyUserID is set to that account's user ID and the buddy's name is
+// replaced with the name on the account. A linked buddy starts out as a pending
+// buddy request unless the other diver has already requested or accepted the
+// buddy's owner, in which case it is accepted, or has blocked them. If an error
+// occurs, an appropriate response is sent to the client and false is returned.
+func (app *app) linkBuddyUser(w http.ResponseWriter, r *http.Request, buddy *data.Buddy) bool {
+	// Only linked buddies have a status, so never trust one from the client.
+	buddy.Status = nil
+
 	// If the buddy's email has been provided, see if it resolves to an active
 	// user account.
-	if input.Email != nil {
-		// Call the User service to see if the given user has a valid account.
-		url := fmt.Sprintf("%s%s%s", app.cfg.svcUser.Addr, "/v1/user/email/", *input.Email)
-		httpResp, res, err := jsonz.RequestJSend(http.MethodGet, url, 2*time.Second, nil)
-		if err != nil {
+	if buddy.Email == nil {
+		return true
+	}
+
+	// Call the User service to see if the given user has a valid account. If
+	// the user could not be found then don't do anything as that just means
+	// the buddy is not a registered user.
+	user, err := app.users.GetByEmail(r.Context(), *buddy.Email)
+	if err != nil {
+		if errors.Is(err, usersvc.ErrNotFound) {
+			return true
+		}
+
+		app.userServiceErrorResponse(w, r, err)
+		return false
+	}
+
+	// Attempt to get the diver record from the database if one exists.
+	d, err := app.models.Divers.GetByID(r.Context(), user.UserID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return true
+		}
+
+		app.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	// Check that the account belonging to the provided email is not that of
+	// the requesting user.
+	if buddy.UserID == d.UserID {
+		e := map[string]string{"email": "Must not be for your own account"}
+		app.FailedValidationResponse(w, r, e)
+		return false
+	}
+
+	// A record was found, so assign their user ID to the BuddyUserID field.
+	// Also use the name provided on their account to avoid any confusion.
+	buddy.BuddyUserID = &d.UserID
+	buddy.Name = user.Name
+
+	// See if the other diver has a buddy record for this one that affects the
+	// status of the new link.
+	status := data.BuddyStatusPending
+	reverse, err := app.models.Buddies.GetOneByUsers(r.Context(), d.UserID, buddy.UserID)
+	switch {
+	case err == nil && reverse.Status != nil:
+		switch *reverse.Status {
+		case data.BuddyStatusPending, data.BuddyStatusAccepted:
+			status = data.BuddyStatusAccepted
+		case data.BuddyStatusBlocked:
+			status = data.BuddyStatusBlocked
+		}
+	case err != nil && !errors.Is(err, data.ErrRecordNotFound):
+		app.ServerErrorResponse(w, r, err)
+		return false
+	}
+	buddy.Status = &status
+
+	return true
+}
+
+// acceptMutualBuddyRequest accepts the other diver's pending buddy request to
+// the owner of the given buddy if the buddy has just been linked and accepted
+// because of it. If an error occurs, an appropriate response is sent to the
+// client and false is returned.
+func (app *app) acceptMutualBuddyRequest(w http.ResponseWriter, r *http.Request, buddy *data.Buddy) bool {
+	if buddy.Status == nil || *buddy.Status != data.BuddyStatusAccepted {
+		return true
+	}
+
+	err := app.models.Buddies.AcceptPending(r.Context(), *buddy.BuddyUserID, buddy.UserID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+func (app *app) listBuddiesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	userID := app.readUserIDParam(r, v)
+	bf := data.BuddyFilters{
+		Organisation: app.ReadString(qs, "organisation", ""),
+		Search:       app.ReadString(qs, "q", ""),
+	}
+	v.Check(len(bf.Search) <= 256, "q", "Must not be more than 256 bytes long")
+	filters := app.readFilters(qs, v, "name", "name", "organisation", "status", "created_at")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	// TODO: Currently returns a 200 and an empty result set if the diverID does
+	// not exist. Might want to check the diverID first.
+	buddies, metadata, err := app.models.Buddies.GetAllForDiver(r.Context(), userID, bf, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	envelope := jsonz.Envelope{"buddies": buddies, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, envelope)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readBuddyParam reads the buddy ID URL parameter from the request and fetches
+// the matching Buddy from the database. If it does not exist, or the parameter
+// is invalid, an appropriate response will be sent and nil will be returned.
+// If asRecipient is true, the buddy must be a request sent to the authenticated
+// user, otherwise it must be one of their own buddies. Buddies that do not meet
+// this are treated as not existing so that their details are not leaked.
+func (app *app) readBuddyParam(w http.ResponseWriter, r *http.Request, asRecipient bool) *data.Buddy {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	buddy, err := app.models.Buddies.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
 			app.ServerErrorResponse(w, r, err)
-			return
 		}
+		return nil
+	}
 
-		// We received an error response, pass it upstream.
-		if res.Status == jsonz.JSendStatusError {
-			app.ServerErrorResponse(w, r, fmt.Errorf(res.Message))
+	userID := app.contextGetPrincipal(r).UserID
+	switch {
+	case asRecipient && (buddy.BuddyUserID == nil || *buddy.BuddyUserID != userID),
+		!asRecipient && buddy.UserID != userID:
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	return buddy
+}
+
+func (app *app) fetchBuddyHandler(w http.ResponseWriter, r *http.Request) {
+	buddy := app.readBuddyParam(w, r, false)
+	if buddy == nil {
+		return
+	}
+
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"buddy": buddy})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateBuddyHandler(w http.ResponseWriter, r *http.Request) {
+	buddy := app.readBuddyParam(w, r, false)
+	if buddy == nil {
+		return
+	}
+
+	// Make sure that nobody else has changed the buddy since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, buddy.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those.
+	var input struct {
+		Name         *string `json:"name"`
+		Email        *string `json:"email"`
+		PhoneNumber  *string `json:"phone_number"`
+		Organisation *string `json:"organisation"`
+		OrgMemberID  *string `json:"org_member_id"`
+		Notes        *string `json:"notes"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		buddy.Name = *input.Name
+	}
+
+	// Email addresses are stored case insensitively, so only treat the email as
+	// changed if it differs by more than just its case.
+	emailChanged := input.Email != nil &&
+		(buddy.Email == nil || !strings.EqualFold(*buddy.Email, *input.Email))
+	if emailChanged {
+		buddy.Email = input.Email
+	}
+
+	if input.PhoneNumber != nil {
+		buddy.PhoneNumber = input.PhoneNumber
+	}
+	if input.Organisation != nil {
+		buddy.Organisation = input.Organisation
+	}
+	if input.OrgMemberID != nil {
+		buddy.OrgMemberID = input.OrgMemberID
+	}
+	if input.Notes != nil {
+		buddy.Notes = input.Notes
+	}
+
+	v := validator.New()
+	data.ValidateBuddy(v, buddy)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The email address may now belong to a different user account, or none at
+	// all, so the link to the old account can no longer be trusted.
+	if emailChanged {
+		buddy.BuddyUserID = nil
+		if !app.linkBuddyUser(w, r, buddy) {
 			return
 		}
+	}
 
-		if res.Status == jsonz.JSendStatusSuccess {
-			// The JSend body contains a success Status, so use a second
-			// decoding pass to decode the JSend Data field into a user struct.
-			userResp := &data.UserResponse{User: data.User{}}
-			err = jsonz.DecodeJSON(bytes.NewReader(res.Data), userResp, true)
-			if err != nil {
+	err = app.models.Buddies.Update(r.Context(), buddy)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
 				app.ServerErrorResponse(w, r, err)
-				return
 			}
+		}
+		return
+	}
 
-			// Attempt to get the diver record from the database if one exists.
-			d, err := app.models.Divers.GetByID(userResp.User.UserID)
-			if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
-				app.ServerErrorResponse(w, r, err)
-				return
-			}
+	if emailChanged && !app.acceptMutualBuddyRequest(w, r, buddy) {
+		return
+	}
 
-			// If a record was found, assign their user ID to the BuddyUserID
-			// field. Also use the name provided on their account to avoid any
-			// confusion.
-			if !errors.Is(err, data.ErrRecordNotFound) {
-				// Check that the account belonging to the provided email is not
-				// that of the requesting user.
-				if input.UserID == d.UserID {
-					e := map[string]string{"email": "Must not be for your own account"}
-					app.FailedValidationResponse(w, r, e)
-					return
-				}
-
-				input.BuddyUserID = &d.UserID
-				input.Name = userResp.User.Name
-			}
-		}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"buddy": buddy})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
 
-		if res.Status == jsonz.JSendStatusFail {
-			// We received a fail response, pass it upstream. If the response
-			// was a 404 then don't do anything as that just means the buddy is
-			// not a registered user.
-			switch {
-			case httpResp.StatusCode != http.StatusNotFound:
-				app.FailResponse(w, r, httpResp.StatusCode, res.Data)
-				return
-			}
-		}
+func (app *app) deleteBuddyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
 	}
 
-	err = app.models.Buddies.Insert(input)
+	err = app.models.Buddies.Delete(r.Context(), app.contextGetPrincipal(r).UserID, id)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "A buddy with this email address already exists")
-			app.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
 		default:
 			app.ServerErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	app.Logger.Info("New buddy successfully added", "user", input.UserID,
-		"buddy", input.Name, "account_linked", input.BuddyUserID != nil)
-
-	b := jsonz.Envelope{"buddy": input}
-	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, nil, b)
+	data := jsonz.Envelope{"message": "Buddy successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
 }
 
-func (app *app) listBuddiesHandler(w http.ResponseWriter, r *http.Request) {
-	var userID string
-
-	params := httprouter.ParamsFromContext(r.Context())
-	userID = params.ByName("id")
+func (app *app) listBuddyRequestsHandler(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
+	userID := app.readUserIDParam(r, v)
 
-	v.Check(validator.Matches(userID, validator.BetterGUIDRX),
-		"user-id", "must be a valid BetterGUID")
+	status := app.ReadString(r.URL.Query(), "status", data.BuddyStatusPending)
+	v.Check(validator.PermittedValue(status, data.BuddyStatusPending,
+		data.BuddyStatusAccepted, data.BuddyStatusDeclined, data.BuddyStatusBlocked),
+		"status", "Must be one of pending, accepted, declined or blocked")
 
 	if !v.Valid() {
 		app.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// TODO: Currently returns a 200 and an empty result set if the diverID does
-	// not exist. Might want to check the diverID first.
-	buddies, err := app.models.Buddies.GetAllForDiver(userID)
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	requests, err := app.models.Buddies.GetRequestsForDiver(r.Context(), userID, status)
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	envelope := jsonz.Envelope{"buddies": buddies}
-	err = jsonz.WriteJSON(w, http.StatusOK, nil, envelope)
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"requests": requests})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) respondBuddyRequestHandler(w http.ResponseWriter, r *http.Request) {
+	request := app.readBuddyParam(w, r, true)
+	if request == nil {
+		return
+	}
+
+	if !app.requireExpectedVersion(w, r, request.Version) {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateBuddyStatusTransition(v, request.Status, input.Status)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	request.Status = &input.Status
+
+	// Accepting or blocking a request is recorded on the recipient's side too
+	// by giving them their own buddy record for the requester.
+	var reciprocal *data.Buddy
+	if input.Status == data.BuddyStatusAccepted || input.Status == data.BuddyStatusBlocked {
+		requester := app.getUserByID(w, r, request.UserID)
+		if requester == nil {
+			return
+		}
+
+		reciprocal = &data.Buddy{
+			UserID:      *request.BuddyUserID,
+			BuddyUserID: &request.UserID,
+			Name:        requester.Name,
+			Email:       &requester.Email,
+			Status:      &input.Status,
+		}
+	}
+
+	err = app.models.Buddies.Respond(r.Context(), request, reciprocal)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("Buddy request responded to", "user", *request.BuddyUserID,
+		"requester", request.UserID, "status", input.Status)
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"request": request.Request()})
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+)
+
+func TestCreateBuddyHandler(t *testing.T) {
+	tests := []struct {
+		name    string
+		userErr error
+		body    any
+		status  int
+		dataKey string
+	}{
+		{
+			name:    "missing name",
+			body:    map[string]any{"email": "buddy@example.com"},
+			status:  http.StatusUnprocessableEntity,
+			dataKey: "name",
+		},
+		{
+			name:    "member ID without an organisation",
+			body:    map[string]any{"name": "Buddy", "org_member_id": "12345"},
+			status:  http.StatusUnprocessableEntity,
+			dataKey: "org_member_id",
+		},
+		{
+			name: "user service rejects the lookup",
+			userErr: &usersvc.FailError{
+				StatusCode: http.StatusTooManyRequests,
+				Data:       json.RawMessage(`{"error":"slow down"}`),
+			},
+			body:    map[string]any{"name": "Buddy", "email": "buddy@example.com"},
+			status:  http.StatusTooManyRequests,
+			dataKey: "error",
+		},
+		{
+			name:    "user service unavailable",
+			userErr: usersvc.ErrCircuitOpen,
+			body:    map[string]any{"name": "Buddy", "email": "buddy@example.com"},
+			status:  http.StatusServiceUnavailable,
+		},
+		{
+			name:    "other failure",
+			userErr: errors.New("connection refused"),
+			body:    map[string]any{"name": "Buddy", "email": "buddy@example.com"},
+			status:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := usersvc.NewFake(
+				data.User{UserID: "u1", Email: "diver@example.com", Name: "Diver"},
+				data.User{UserID: "u2", Email: "buddy@example.com", Name: "Buddy"},
+			)
+			users.Err = tt.userErr
+			app := newTestApp(t, users)
+
+			status, res := serve(t, app, http.HandlerFunc(app.createBuddyHandler), http.MethodPost, "u1", "", tt.body)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.status, res)
+			}
+			if _, ok := res.Data[tt.dataKey]; tt.dataKey != "" && !ok {
+				t.Errorf("got data %v, want a %q key", res.Data, tt.dataKey)
+			}
+		})
+	}
+}
+
+// TestCreateBuddyHandlerCircuitOpen checks that clients are told when to retry
+// while the User service client's circuit breaker is open.
+func TestCreateBuddyHandlerCircuitOpen(t *testing.T) {
+	users := usersvc.NewFake()
+	users.Err = usersvc.ErrCircuitOpen
+	app := newTestApp(t, users)
+	app.cfg.usersvc.BreakerCooldown = 1500 * time.Millisecond
+
+	body := strings.NewReader(`{"name": "Buddy", "email": "buddy@example.com"}`)
+	r := httptest.NewRequest(http.MethodPost, "/", body)
+	r = app.contextSetPrincipal(r, &auth.Principal{UserID: "u1", Roles: []string{auth.RoleDiver}})
+
+	rr := httptest.NewRecorder()
+	app.createBuddyHandler(rr, r)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want %d", rr.Code, http.StatusServiceUnavailable)
+	}
+	if got := rr.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("got Retry-After %q, want %q", got, "2")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+func (app *app) createCertificationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		AgencyID         int64          `json:"agency_id"`
+		CourseID         int64          `json:"course_id"`
+		CertNumber       *string        `json:"cert_number"`
+		IssueDate        jsonz.DateOnly `json:"issue_date"`
+		Instructor       *string        `json:"instructor"`
+		DiveCentre       *string        `json:"dive_centre"`
+		InstructorUserID *string        `json:"instructor_user_id"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	cert := &data.Certification{
+		UserID:           app.contextGetPrincipal(r).UserID,
+		AgencyID:         input.AgencyID,
+		CourseID:         input.CourseID,
+		CertNumber:       input.CertNumber,
+		IssueDate:        input.IssueDate,
+		Instructor:       input.Instructor,
+		DiveCentre:       input.DiveCentre,
+		InstructorUserID: input.InstructorUserID,
+	}
+
+	v := validator.New()
+
+	data.ValidateCertification(v, cert)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Certifications can only be recorded against registered divers.
+	_, err = app.models.Divers.GetByID(r.Context(), cert.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Check that the course exists and is offered by the given agency.
+	course, err := app.models.AgencyCourses.GetOneByID(r.Context(), cert.AgencyID, cert.CourseID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("course_id", "Must be a course offered by the given agency")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	cert.CourseName = course.Name
+
+	err = app.models.Certifications.Insert(r.Context(), cert)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("New certification successfully added", "user", cert.UserID,
+		"course", cert.CourseID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/certification/id/%d", cert.ID))
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, headers, jsonz.Envelope{"certification": cert})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) fetchCertificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	cert, err := app.models.Certifications.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Don't reveal that other divers' certifications exist.
+	if cert.UserID != app.contextGetPrincipal(r).UserID {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	data := jsonz.Envelope{"certification": cert}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listCertificationsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	userID := app.readUserIDParam(r, v)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	certs, err := app.models.Certifications.GetAllForDiver(r.Context(), userID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"certifications": certs}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) signCertificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	cert, err := app.models.Certifications.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Instructors may only sign the certifications that divers have asked them
+	// to, and don't learn that any others exist.
+	principal := app.contextGetPrincipal(r)
+	if cert.InstructorUserID == nil || *cert.InstructorUserID != principal.UserID {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireExpectedVersion(w, r, cert.Version) {
+		return
+	}
+
+	// Instructors cannot vouch for their own certifications.
+	if cert.UserID == principal.UserID {
+		app.NotPermittedResponse(w, r)
+		return
+	}
+
+	if cert.SignedBy != nil {
+		v := validator.New()
+		v.AddError("form", "The certification has already been signed")
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Certifications.Sign(r.Context(), cert, principal.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("Certification signed", "user", cert.UserID, "id", cert.ID,
+		"instructor", principal.UserID)
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"certification": cert})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) deleteCertificationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Certifications.Delete(r.Context(), app.contextGetPrincipal(r).UserID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Certification successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
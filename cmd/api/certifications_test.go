@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+)
+
+// certificationQuery answers the lookup of version 1 of certification 5, held
+// by the diver u1, which they have asked the given instructor to sign.
+func certificationQuery(instructorUserID any) testQuery {
+	return testQuery{
+		match: "from certifications",
+		rows: [][]driver.Value{{
+			int64(5), int64(1), time.Now(), time.Now(), "u1", int64(1), int64(2),
+			"Open Water Diver", nil, time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC),
+			nil, nil, instructorUserID, nil, nil,
+		}},
+	}
+}
+
+func TestSignCertificationHandler(t *testing.T) {
+	signQuery := testQuery{
+		match: "update certifications",
+		rows:  [][]driver.Value{{"i1", time.Now(), int64(2), time.Now()}},
+	}
+
+	tests := []struct {
+		name         string
+		instructorID string
+		queries      []testQuery
+		status       int
+	}{
+		{
+			name:         "requested instructor",
+			instructorID: "i1",
+			queries:      []testQuery{certificationQuery("i1"), signQuery},
+			status:       http.StatusOK,
+		},
+		{
+			// The signing statement is not expected, so the test fails if the
+			// certification is signed.
+			name:         "another instructor",
+			instructorID: "i2",
+			queries:      []testQuery{certificationQuery("i1")},
+			status:       http.StatusNotFound,
+		},
+		{
+			name:         "no instructor requested",
+			instructorID: "i1",
+			queries:      []testQuery{certificationQuery(nil)},
+			status:       http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, usersvc.NewFake(), tt.queries...)
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.Header.Set("X-Expected-Version", "1")
+			params := httprouter.Params{{Key: "id", Value: "5"}}
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, params))
+			principal := &auth.Principal{UserID: tt.instructorID, Roles: []string{auth.RoleInstructor}}
+			r = app.contextSetPrincipal(r, principal)
+
+			rr := httptest.NewRecorder()
+			app.signCertificationHandler(rr, r)
+
+			var res testResponse
+			err := json.NewDecoder(rr.Body).Decode(&res)
+			if err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+
+			if rr.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %+v", rr.Code, tt.status, res)
+			}
+			if _, ok := res.Data["certification"]; ok != (tt.status == http.StatusOK) {
+				t.Errorf("got data %v, want a certification only on success", res.Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+)
+
+type contextKey string
+
+const principalContextKey = contextKey("principal")
+
+// contextSetPrincipal returns a copy of the request with the given Principal
+// added to its context.
+func (app *app) contextSetPrincipal(r *http.Request, principal *auth.Principal) *http.Request {
+	ctx := context.WithValue(r.Context(), principalContextKey, principal)
+	return r.WithContext(ctx)
+}
+
+// contextGetPrincipal returns the Principal from the request context. It
+// should only be used for requests that have been through the authenticate
+// middleware, so a missing value is a bug and causes a panic.
+func (app *app) contextGetPrincipal(r *http.Request) *auth.Principal {
+	principal, ok := r.Context().Value(principalContextKey).(*auth.Principal)
+	if !ok {
+		panic("missing principal value in request context")
+	}
+
+	return principal
+}
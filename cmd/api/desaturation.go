@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/deco"
+	"github.com/m5lapp/go-dive-diver-service/internal/profile"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+const (
+	// desaturationLookback is how far back a diver's dives are modelled from.
+	// After this long, even the slowest compartment has given off nearly all
+	// of the gas that it took up.
+	desaturationLookback = 96 * time.Hour
+	// desaturationGF is the gradient factor used to decide whether a logged
+	// dive needed decompression and when it is safe to fly. It is as
+	// conservative as the default GF high of most dive computers.
+	desaturationGF = 0.85
+)
+
+// The Divers Alert Network's minimum surface intervals before flying after a
+// single no-decompression dive, after repetitive dives and after dives that
+// needed decompression stops. Repetitive dives are those that surfaced within
+// repetitiveWindow of the last dive.
+const (
+	noFlySingleDive  = 12 * time.Hour
+	noFlyRepetitive  = 18 * time.Hour
+	noFlyDecoDive    = 24 * time.Hour
+	repetitiveWindow = 48 * time.Hour
+)
+
+// desaturation describes how much of the gas taken up on a diver's recent
+// dives they still hold. Times are in the diver's default diving time zone and
+// durations are in whole minutes.
+type desaturation struct {
+	TimeZone         string     `json:"time_zone"`
+	Dives            int        `json:"dives"`
+	LastDiveID       *int64     `json:"last_dive_id,omitempty"`
+	LastSurfacedAt   *time.Time `json:"last_surfaced_at,omitempty"`
+	SurfaceInterval  *int       `json:"surface_interval,omitempty"`
+	DesaturationTime int        `json:"desaturation_time"`
+	DesaturatedAt    *time.Time `json:"desaturated_at,omitempty"`
+	NoFlyTime        int        `json:"no_fly_time"`
+	NoFlyUntil       *time.Time `json:"no_fly_until,omitempty"`
+}
+
+// modelledDive is the part of a dive's history that is needed to work out the
+// minimum surface interval before flying.
+type modelledDive struct {
+	surfacedAt time.Time
+	deco       bool
+}
+
+func (app *app) fetchDesaturationHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	userID := app.readUserIDParam(r, v)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	diver, err := app.models.Divers.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	now := time.Now()
+	loc := diverLocation(diver)
+
+	dives, err := app.models.Dives.GetRecentForDiver(r.Context(), userID, now.Add(-desaturationLookback))
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	tissues := deco.NewTissues()
+	modelled := make([]modelledDive, 0, len(dives))
+
+	for _, dive := range dives {
+		if n := len(modelled); n > 0 {
+			interval := dive.StartedAt.Sub(modelled[n-1].surfacedAt)
+			tissues.Expose(0, 0, math.Max(0, interval.Minutes()), deco.Air)
+		}
+
+		md, err := app.modelDive(r.Context(), &tissues, dive)
+		if err != nil {
+			app.ServerErrorResponse(w, r, err)
+			return
+		}
+		modelled = append(modelled, md)
+	}
+
+	result := desaturation{TimeZone: loc.String(), Dives: len(dives)}
+
+	if len(dives) > 0 {
+		last := modelled[len(modelled)-1].surfacedAt
+		interval := max(0, now.Sub(last))
+		tissues.Expose(0, 0, interval.Minutes(), deco.Air)
+
+		result.DesaturationTime = tissues.DesaturationTime()
+		result.NoFlyTime = max(tissues.NoFlyTime(desaturationGF), noFlyRuleMinutes(modelled, interval))
+
+		lastSurfaced := last.In(loc)
+		intervalMins := int(interval.Minutes())
+		desaturatedAt := now.Add(time.Duration(result.DesaturationTime) * time.Minute).In(loc)
+		noFlyUntil := now.Add(time.Duration(result.NoFlyTime) * time.Minute).In(loc)
+
+		result.LastDiveID = &dives[len(dives)-1].ID
+		result.LastSurfacedAt = &lastSurfaced
+		result.SurfaceInterval = &intervalMins
+		result.DesaturatedAt = &desaturatedAt
+		result.NoFlyUntil = &noFlyUntil
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"desaturation": result})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// modelDive loads the given tissues with the gas taken up on the given dive,
+// following its profile if it has one. Otherwise, the diver is taken to have
+// spent the whole bottom time at the maximum depth, which overestimates the
+// gas taken up. The gas in the dive's first cylinder, or air if it has none, is
+// taken to have been breathed throughout, as gas switches are not recorded.
+func (app *app) modelDive(ctx context.Context, tissues *deco.Tissues, dive *data.Dive) (modelledDive, error) {
+	samples, err := app.models.Dives.GetProfile(ctx, dive.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			samples = squareProfile(dive)
+		default:
+			return modelledDive{}, err
+		}
+	}
+
+	gas := deco.Air
+	if len(dive.Cylinders) > 0 {
+		gas = deco.Gas{O2: dive.Cylinders[0].O2 / 100, He: dive.Cylinders[0].He / 100}
+	}
+
+	md := modelledDive{}
+	var prev profile.Sample
+	for _, s := range samples {
+		tissues.Expose(prev.Depth, s.Depth, float64(s.Elapsed-prev.Elapsed)/60, gas)
+		if tissues.Ceiling(desaturationGF) > 0 {
+			md.deco = true
+		}
+		prev = s
+	}
+
+	// Profiles often end before the diver reaches the surface.
+	ascent := prev.Depth / deco.DefaultAscentRate
+	tissues.Expose(prev.Depth, 0, ascent, gas)
+
+	elapsed := time.Duration(prev.Elapsed)*time.Second + time.Duration(ascent*float64(time.Minute))
+	md.surfacedAt = dive.StartedAt.Add(elapsed)
+
+	return md, nil
+}
+
+// squareProfile returns a profile for a dive that has none, in which the
+// diver descends to its maximum depth and stays there until the end of its
+// bottom time.
+func squareProfile(dive *data.Dive) []profile.Sample {
+	descent := int(math.Ceil(dive.MaxDepth / deco.DefaultDescentRate * 60))
+	bottom := dive.BottomTime * 60
+
+	return []profile.Sample{
+		{Elapsed: min(descent, bottom), Depth: dive.MaxDepth},
+		{Elapsed: max(descent, bottom), Depth: dive.MaxDepth},
+	}
+}
+
+// noFlyRuleMinutes returns the number of whole minutes left until the Divers
+// Alert Network's minimum surface interval before flying has passed, given
+// the modelled dives and the time since the last of them surfaced.
+func noFlyRuleMinutes(dives []modelledDive, interval time.Duration) int {
+	last := dives[len(dives)-1].surfacedAt
+
+	rule := noFlySingleDive
+	repetitive := 0
+	for _, dive := range dives {
+		if last.Sub(dive.surfacedAt) > repetitiveWindow {
+			continue
+		}
+		if dive.deco {
+			rule = noFlyDecoDive
+			break
+		}
+		repetitive++
+	}
+	if rule != noFlyDecoDive && repetitive > 1 {
+		rule = noFlyRepetitive
+	}
+
+	return int(math.Ceil(max(0, rule-interval).Minutes()))
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/subsurface"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// exportPageSize is the number of dives fetched from the database at a time
+// when exporting a diver's log book.
+const exportPageSize = 100
+
+func (app *app) exportSubsurfaceHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	userID := app.readUserIDParam(r, v)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	diver, err := app.models.Divers.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	dives, err := app.subsurfaceDives(r.Context(), userID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// Write the whole file before sending anything, so that an error part of
+	// the way through can still be reported properly.
+	var buf bytes.Buffer
+	err = subsurface.Write(&buf, dives, diverLocation(diver))
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="dives.ssrf"`)
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// subsurfaceDives fetches all of the dives logged by the diver with the given
+// userID, in the order that they started, and converts them for writing to a
+// Subsurface log. The dives keep their numbers, so the diver's
+// DiveNumberOffset is respected.
+func (app *app) subsurfaceDives(ctx context.Context, userID string) ([]*subsurface.Dive, error) {
+	buddyNames, err := app.models.Buddies.GetNamesForDiver(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := make(map[int64]*subsurface.Site)
+	dives := []*subsurface.Dive{}
+
+	filters := data.Filters{
+		Page:         1,
+		PageSize:     exportPageSize,
+		Sort:         "started_at",
+		SortSafelist: []string{"started_at"},
+	}
+
+	for {
+		page, metadata, err := app.models.Dives.GetAllForDiver(ctx, userID, filters)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, dive := range page {
+			sd, err := app.subsurfaceDive(ctx, dive, buddyNames, sites)
+			if err != nil {
+				return nil, err
+			}
+			dives = append(dives, sd)
+		}
+
+		if filters.Page >= metadata.LastPage {
+			break
+		}
+		filters.Page++
+	}
+
+	return dives, nil
+}
+
+// subsurfaceDive converts the given Dive for writing to a Subsurface log,
+// fetching its profile and catalogue site. The buddies' names are
+// looked up in buddyNames, and any catalogue sites that are fetched are
+// remembered in sites so that each is only fetched once.
+func (app *app) subsurfaceDive(ctx context.Context, dive *data.Dive, buddyNames map[int64]string, sites map[int64]*subsurface.Site) (*subsurface.Dive, error) {
+	sd := &subsurface.Dive{
+		Number:           dive.Number,
+		StartedAt:        dive.StartedAt,
+		Duration:         time.Duration(dive.BottomTime) * time.Minute,
+		MaxDepth:         dive.MaxDepth,
+		WaterTemperature: dive.WaterTemp,
+	}
+
+	switch {
+	case dive.SiteID != nil:
+		site, ok := sites[*dive.SiteID]
+		if !ok {
+			ds, err := app.models.DiveSites.GetOneByID(ctx, *dive.SiteID)
+			if err != nil {
+				return nil, fmt.Errorf("fetching site of dive %d: %w", dive.ID, err)
+			}
+			site = &subsurface.Site{Name: ds.Name, Latitude: &ds.Latitude, Longitude: &ds.Longitude}
+			sites[*dive.SiteID] = site
+		}
+		sd.Site = site
+	case dive.Site != nil:
+		sd.Site = &subsurface.Site{Name: *dive.Site}
+	}
+
+	for _, id := range dive.BuddyIDs {
+		if name, ok := buddyNames[id]; ok {
+			sd.Buddies = append(sd.Buddies, name)
+		}
+	}
+
+	for _, c := range dive.Cylinders {
+		cyl := subsurface.Cylinder{
+			Size:          c.Size,
+			WorkPressure:  c.WorkPressure,
+			StartPressure: c.StartPressure,
+			EndPressure:   c.EndPressure,
+			O2:            c.O2,
+			He:            c.He,
+		}
+		if c.Description != nil {
+			cyl.Description = *c.Description
+		}
+		sd.Cylinders = append(sd.Cylinders, cyl)
+	}
+
+	samples, err := app.models.Dives.GetProfile(ctx, dive.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return nil, err
+	}
+	for _, s := range samples {
+		sd.Samples = append(sd.Samples, subsurface.Sample{
+			Elapsed:     time.Duration(s.Elapsed) * time.Second,
+			Depth:       s.Depth,
+			Temperature: s.Temperature,
+			Pressure:    s.Pressure,
+			PPO2:        s.PPO2,
+		})
+	}
+
+	// Prefer the full length of the dive from its profile over the bottom
+	// time, which is rounded up to the minute.
+	if len(samples) > 0 {
+		sd.Duration = time.Duration(samples[len(samples)-1].Elapsed) * time.Second
+	}
+
+	return sd, nil
+}
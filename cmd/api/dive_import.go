@@ -0,0 +1,368 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/profile"
+	"github.com/m5lapp/go-dive-diver-service/internal/subsurface"
+	"github.com/m5lapp/go-dive-diver-service/internal/uddf"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// maxImportBytes is the largest dive log file that may be imported.
+const maxImportBytes = 16 << 20
+
+// maxImportDives is the largest number of dives that may be imported from a
+// single file.
+const maxImportDives = 1000
+
+// The statuses of a dive in an import report.
+const (
+	importStatusImported = "imported"
+	importStatusSkipped  = "skipped"
+	importStatusFailed   = "failed"
+)
+
+// diveImportResult reports what happened to a single dive from an imported
+// file. The SourceID is the dive's ID within the file, if it had one.
+type diveImportResult struct {
+	SourceID         string            `json:"source_id,omitempty"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	Status           string            `json:"status"`
+	DiveID           int64             `json:"dive_id,omitempty"`
+	Errors           map[string]string `json:"errors,omitempty"`
+	UnmatchedBuddies []string          `json:"unmatched_buddies,omitempty"`
+}
+
+// importedBuddy is a buddy named in an imported file, who may be identified by
+// their name, email address or both.
+type importedBuddy struct {
+	name  string
+	email string
+}
+
+// importedDive is a dive read from an imported file, converted into a
+// data.Dive ready to be logged once the buddies named in the file have been
+// matched to the diver's own. If the dive could not be read, err says why and
+// dive is nil.
+type importedDive struct {
+	sourceID string
+	dive     *data.Dive
+	buddies  []importedBuddy
+	err      error
+}
+
+func (app *app) importUDDFHandler(w http.ResponseWriter, r *http.Request) {
+	diver, loc := app.readImportDiver(w, r)
+	if diver == nil {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	dives, err := uddf.Parse(r.Body, loc)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	imported := make([]importedDive, 0, len(dives))
+	for _, ud := range dives {
+		id := importedDive{sourceID: ud.ID, err: ud.Err}
+		if ud.Err == nil {
+			id.dive = &data.Dive{
+				StartedAt:  ud.StartedAt,
+				MaxDepth:   ud.MaxDepth,
+				BottomTime: int(math.Ceil(ud.Duration.Minutes())),
+				WaterTemp:  ud.MinTemperature,
+			}
+			if ud.Site != "" {
+				id.dive.Site = &ud.Site
+			}
+			for _, s := range ud.Samples {
+				id.dive.Samples = appendSample(id.dive.Samples, s.Elapsed, s.Depth, s.Temperature, s.Pressure, s.PPO2)
+			}
+			for _, b := range ud.Buddies {
+				id.buddies = append(id.buddies, importedBuddy{name: b.Name, email: b.Email})
+			}
+		}
+		imported = append(imported, id)
+	}
+
+	app.importDives(w, r, diver.UserID, "uddf", imported)
+}
+
+func (app *app) importSubsurfaceHandler(w http.ResponseWriter, r *http.Request) {
+	diver, loc := app.readImportDiver(w, r)
+	if diver == nil {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	dives, err := subsurface.Parse(r.Body, loc)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	imported := make([]importedDive, 0, len(dives))
+	for i, sd := range dives {
+		// Subsurface dives have no IDs, so they are identified by their
+		// position in the file instead.
+		id := importedDive{sourceID: fmt.Sprint(i + 1), err: sd.Err}
+		if sd.Err == nil {
+			id.dive = &data.Dive{
+				StartedAt:  sd.StartedAt,
+				MaxDepth:   sd.MaxDepth,
+				BottomTime: int(math.Ceil(sd.Duration.Minutes())),
+				WaterTemp:  sd.WaterTemperature,
+			}
+			if sd.Site != nil && sd.Site.Name != "" {
+				id.dive.Site = &sd.Site.Name
+			}
+			for _, s := range sd.Samples {
+				id.dive.Samples = appendSample(id.dive.Samples, s.Elapsed, s.Depth, s.Temperature, s.Pressure, s.PPO2)
+			}
+			for _, c := range sd.Cylinders {
+				cyl := data.DiveCylinder{
+					Size:          c.Size,
+					WorkPressure:  c.WorkPressure,
+					StartPressure: c.StartPressure,
+					EndPressure:   c.EndPressure,
+					O2:            c.O2,
+					He:            c.He,
+				}
+				if c.Description != "" {
+					cyl.Description = &c.Description
+				}
+				id.dive.Cylinders = append(id.dive.Cylinders, cyl)
+			}
+			for _, name := range sd.Buddies {
+				id.buddies = append(id.buddies, importedBuddy{name: name})
+			}
+		}
+		imported = append(imported, id)
+	}
+
+	app.importDives(w, r, diver.UserID, "subsurface", imported)
+}
+
+// readImportDiver fetches the Diver record of the authenticated user, along
+// with the location that dates and times in their dive log files are taken to
+// be in. If the user is not a registered diver, an appropriate response will
+// be sent and nil will be returned.
+func (app *app) readImportDiver(w http.ResponseWriter, r *http.Request) (*data.Diver, *time.Location) {
+	diver, err := app.models.Divers.GetByID(r.Context(), app.contextGetPrincipal(r).UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil, nil
+	}
+
+	return diver, diverLocation(diver)
+}
+
+// diverLocation returns the location of the given Diver's default diving time
+// zone, or UTC if they have none. Dive computers usually record local time, so
+// this is the time zone that dive log files are read and written in.
+func diverLocation(diver *data.Diver) *time.Location {
+	if diver.DefaultDivingTZ != nil {
+		if loc, err := time.LoadLocation(*diver.DefaultDivingTZ); err == nil {
+			return loc
+		}
+	}
+
+	return time.UTC
+}
+
+// importDives logs each of the given dives read from a file in the given
+// format for the diver with the given userID and sends a report of what
+// happened to each of them. A dive that cannot be logged does not stop the
+// others from being logged.
+func (app *app) importDives(w http.ResponseWriter, r *http.Request, userID, format string, dives []importedDive) {
+	if len(dives) > maxImportDives {
+		v := validator.New()
+		v.AddError("file", fmt.Sprintf("Must contain a maximum of %d dives", maxImportDives))
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	buddies := app.newBuddyMatcher(r, userID)
+	results := make([]diveImportResult, 0, len(dives))
+	imported, skipped, failed := 0, 0, 0
+
+	for _, id := range dives {
+		result := app.importDive(r, userID, id, buddies)
+
+		switch result.Status {
+		case importStatusImported:
+			imported++
+		case importStatusSkipped:
+			skipped++
+		case importStatusFailed:
+			failed++
+		}
+
+		results = append(results, result)
+	}
+
+	app.Logger.Info("Dive log imported", "user", userID, "format", format,
+		"imported", imported, "skipped", skipped, "failed", failed)
+
+	data := jsonz.Envelope{
+		"imported": imported,
+		"skipped":  skipped,
+		"failed":   failed,
+		"results":  results,
+	}
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// importDive logs a single dive read from an imported file for the diver with
+// the given userID and reports what happened. Dives that the diver has
+// already logged are skipped, so that the same file can safely be imported
+// again.
+func (app *app) importDive(r *http.Request, userID string, id importedDive, buddies *buddyMatcher) diveImportResult {
+	result := diveImportResult{SourceID: id.sourceID, Status: importStatusFailed}
+
+	if id.err != nil {
+		result.Errors = map[string]string{"dive": id.err.Error()}
+		return result
+	}
+
+	dive := id.dive
+	dive.UserID = userID
+	dive.MaxDepth = math.Round(dive.MaxDepth*100) / 100
+	dive.BuddyIDs = []int64{}
+	result.StartedAt = &dive.StartedAt
+
+	exists, err := app.models.Dives.ExistsAt(r.Context(), userID, dive.StartedAt)
+	if err != nil {
+		app.logImportError(r, err)
+		result.Errors = map[string]string{"dive": "The dive could not be saved"}
+		return result
+	}
+	if exists {
+		result.Status = importStatusSkipped
+		result.Errors = map[string]string{"started_at": "A dive starting at this time is already logged"}
+		return result
+	}
+
+	for _, b := range id.buddies {
+		buddyID, ok, err := buddies.match(b)
+		if err != nil {
+			app.logImportError(r, err)
+			result.Errors = map[string]string{"buddies": "The dive's buddies could not be matched"}
+			return result
+		}
+		if !ok {
+			name := b.name
+			if name == "" {
+				name = b.email
+			}
+			result.UnmatchedBuddies = append(result.UnmatchedBuddies, name)
+			continue
+		}
+		// The same buddy may be listed more than once in the file.
+		if !slices.Contains(dive.BuddyIDs, buddyID) {
+			dive.BuddyIDs = append(dive.BuddyIDs, buddyID)
+		}
+	}
+
+	v := validator.New()
+
+	data.ValidateDive(v, dive)
+	if !v.Valid() {
+		result.Errors = v.Errors
+		return result
+	}
+
+	err = app.models.Dives.Insert(r.Context(), dive)
+	if err != nil {
+		app.logImportError(r, err)
+		result.Errors = map[string]string{"dive": "The dive could not be saved"}
+		return result
+	}
+
+	result.Status = importStatusImported
+	result.DiveID = dive.ID
+
+	return result
+}
+
+// logImportError logs an unexpected error while importing a single dive. The
+// import carries on with the next dive, so no response is sent.
+func (app *app) logImportError(r *http.Request, err error) {
+	app.Logger.Error(err.Error(), "request_method", r.Method,
+		"request_url", r.URL.String())
+}
+
+// appendSample appends a sample from an imported file to samples, rounding the
+// time to the nearest second. If more than one sample falls in the same
+// second, only the first is kept.
+func appendSample(samples []profile.Sample, elapsed time.Duration, depth float64, temp, pressure, ppo2 *float64) []profile.Sample {
+	secs := int(elapsed.Round(time.Second).Seconds())
+	if len(samples) > 0 && secs <= samples[len(samples)-1].Elapsed {
+		return samples
+	}
+
+	return append(samples, profile.Sample{
+		Elapsed:     secs,
+		Depth:       math.Round(depth*100) / 100,
+		Temperature: temp,
+		Pressure:    pressure,
+		PPO2:        ppo2,
+	})
+}
+
+// buddyMatcher maps the buddies named in an imported file to the diver's
+// existing Buddy records by email address or name, remembering the results so
+// that each buddy is only looked up once per file. Failed lookups are not
+// remembered, so they are tried again for the next dive that names the buddy.
+type buddyMatcher struct {
+	app    *app
+	r      *http.Request
+	userID string
+	found  map[importedBuddy]int64
+}
+
+func (app *app) newBuddyMatcher(r *http.Request, userID string) *buddyMatcher {
+	return &buddyMatcher{
+		app:    app,
+		r:      r,
+		userID: userID,
+		found:  make(map[importedBuddy]int64),
+	}
+}
+
+// match returns the ID of the diver's buddy matching b and true, or false if
+// there is no such buddy. Unmatched buddies are remembered with an ID of zero.
+func (bm *buddyMatcher) match(b importedBuddy) (int64, bool, error) {
+	if id, ok := bm.found[b]; ok {
+		return id, id != 0, nil
+	}
+
+	id, err := bm.app.models.Buddies.FindIDForDiver(bm.r.Context(), bm.userID, b.name, b.email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return 0, false, err
+	}
+
+	bm.found[b] = id
+
+	return id, id != 0, nil
+}
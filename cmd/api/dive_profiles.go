@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/profile"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// maxProfilePoints is the largest number of points that a profile may be
+// downsampled to.
+const maxProfilePoints = 5000
+
+func (app *app) fetchDiveProfileHandler(w http.ResponseWriter, r *http.Request) {
+	dive := app.readDiveParam(w, r)
+	if dive == nil {
+		return
+	}
+
+	v := validator.New()
+
+	// By default, the whole profile is returned.
+	points := app.ReadInt(r.URL.Query(), "points", 0, v)
+	if points != 0 {
+		v.Check(points >= 3, "points", "Must be at least 3")
+		v.Check(points <= maxProfilePoints, "points", "Must be a maximum of 5000")
+	}
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	samples, err := app.models.Dives.GetProfile(r.Context(), dive.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Profiles imported before they were summarised have no stored summary.
+	summary := dive.Profile
+	if summary == nil {
+		s := profile.Summarise(samples)
+		summary = &s
+	}
+
+	if points != 0 {
+		samples = profile.Downsample(samples, points)
+	}
+
+	env := jsonz.Envelope{"summary": summary, "samples": samples}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateDiveProfileHandler(w http.ResponseWriter, r *http.Request) {
+	dive := app.readDiveParam(w, r)
+	if dive == nil {
+		return
+	}
+
+	if !app.requireExpectedVersion(w, r, dive.Version) {
+		return
+	}
+
+	var input struct {
+		Samples []profile.Sample `json:"samples"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	dive.Samples = input.Samples
+
+	v := validator.New()
+
+	data.ValidateProfile(v, dive.Samples)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Dives.SetProfile(r.Context(), dive)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"dive": dive})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+func (app *app) createDiveSiteHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Country     string   `json:"country"`
+		Region      *string  `json:"region"`
+		Latitude    float64  `json:"latitude"`
+		Longitude   float64  `json:"longitude"`
+		MaxDepth    *float64 `json:"max_depth"`
+		EntryType   *string  `json:"entry_type"`
+		Description *string  `json:"description"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	userID := app.contextGetPrincipal(r).UserID
+
+	site := &data.DiveSite{
+		CreatedBy:   &userID,
+		Name:        input.Name,
+		Country:     input.Country,
+		Region:      input.Region,
+		Latitude:    input.Latitude,
+		Longitude:   input.Longitude,
+		MaxDepth:    input.MaxDepth,
+		EntryType:   input.EntryType,
+		Description: input.Description,
+	}
+
+	v := validator.New()
+
+	data.ValidateDiveSite(v, site)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Dive sites can only be added to the catalogue by registered divers.
+	_, err = app.models.Divers.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.DiveSites.Insert(r.Context(), site)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("New dive site successfully created", "user", userID,
+		"site", site.ID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/dive-site/id/%d", site.ID))
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, headers, jsonz.Envelope{"dive_site": site})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readDiveSiteParam reads the dive site ID URL parameter from the request and
+// fetches the matching DiveSite from the database. If it does not exist or the
+// parameter is invalid, an appropriate response will be sent and nil will be
+// returned.
+func (app *app) readDiveSiteParam(w http.ResponseWriter, r *http.Request) *data.DiveSite {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	site, err := app.models.DiveSites.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return site
+}
+
+// canEditDiveSite reports whether the authenticated user may edit or delete
+// the given DiveSite. Divers may change the sites that they added themselves,
+// any others need the auth.CanManageDiveSites permission.
+func (app *app) canEditDiveSite(r *http.Request, site *data.DiveSite) bool {
+	principal := app.contextGetPrincipal(r)
+
+	if site.CreatedBy != nil && *site.CreatedBy == principal.UserID {
+		return true
+	}
+
+	return auth.CanManageDiveSites(principal)
+}
+
+func (app *app) fetchDiveSiteHandler(w http.ResponseWriter, r *http.Request) {
+	site := app.readDiveSiteParam(w, r)
+	if site == nil {
+		return
+	}
+
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"dive_site": site})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listDiveSitesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	sf := data.DiveSiteFilters{
+		Country: app.ReadString(qs, "country", ""),
+		Search:  app.ReadString(qs, "q", ""),
+	}
+	v.Check(len(sf.Search) <= 256, "q", "Must not be more than 256 bytes long")
+	filters := app.readFilters(qs, v, "name", "name", "country", "region", "created_at")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sites, metadata, err := app.models.DiveSites.GetAll(r.Context(), sf, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"dive_sites": sites, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listNearbyDiveSitesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	lat := app.readFloat(qs, "latitude", v)
+	lon := app.readFloat(qs, "longitude", v)
+	v.Check(lat != nil, "latitude", "Must be provided")
+	v.Check(lon != nil, "longitude", "Must be provided")
+	if lat != nil && lon != nil {
+		data.ValidateCoordinates(v, *lat, *lon)
+	}
+
+	radius := 10.0
+	if rp := app.readFloat(qs, "radius", v); rp != nil {
+		radius = *rp
+	}
+	v.Check(radius > 0, "radius", "Must be greater than zero")
+	v.Check(radius <= 500, "radius", "Must be a maximum of 500 kilometres")
+
+	// The results are always sorted by distance, so the sort parameter is
+	// ignored.
+	filters := app.readFilters(qs, v, "distance", "distance")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sites, metadata, err := app.models.DiveSites.GetAllNear(r.Context(), *lat, *lon, radius, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"dive_sites": sites, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateDiveSiteHandler(w http.ResponseWriter, r *http.Request) {
+	site := app.readDiveSiteParam(w, r)
+	if site == nil {
+		return
+	}
+
+	if !app.canEditDiveSite(r, site) {
+		app.NotPermittedResponse(w, r)
+		return
+	}
+
+	// Make sure that nobody else has changed the site since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, site.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those.
+	var input struct {
+		Name        *string  `json:"name"`
+		Country     *string  `json:"country"`
+		Region      *string  `json:"region"`
+		Latitude    *float64 `json:"latitude"`
+		Longitude   *float64 `json:"longitude"`
+		MaxDepth    *float64 `json:"max_depth"`
+		EntryType   *string  `json:"entry_type"`
+		Description *string  `json:"description"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		site.Name = *input.Name
+	}
+	if input.Country != nil {
+		site.Country = *input.Country
+	}
+	if input.Region != nil {
+		site.Region = input.Region
+	}
+	if input.Latitude != nil {
+		site.Latitude = *input.Latitude
+	}
+	if input.Longitude != nil {
+		site.Longitude = *input.Longitude
+	}
+	if input.MaxDepth != nil {
+		site.MaxDepth = input.MaxDepth
+	}
+	if input.EntryType != nil {
+		site.EntryType = input.EntryType
+	}
+	if input.Description != nil {
+		site.Description = input.Description
+	}
+
+	v := validator.New()
+
+	data.ValidateDiveSite(v, site)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.DiveSites.Update(r.Context(), site)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"dive_site": site})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) deleteDiveSiteHandler(w http.ResponseWriter, r *http.Request) {
+	site := app.readDiveSiteParam(w, r)
+	if site == nil {
+		return
+	}
+
+	if !app.canEditDiveSite(r, site) {
+		app.NotPermittedResponse(w, r)
+		return
+	}
+
+	err := app.models.DiveSites.Delete(r.Context(), site.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Dive site successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
@@ -1,21 +1,27 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
 	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
 
+// linkBuddiesTimeout is how long linking a new diver to the buddy records that
+// other divers already hold for them may take in the background.
+const linkBuddiesTimeout = time.Minute
+
 func (app *app) createDiverHandler(w http.ResponseWriter, r *http.Request) {
 	input := struct {
 		data.Diver
-		Email string `json:"email"`
+		InvitationToken *string `json:"invitation_token"`
 	}{}
 
 	err := jsonz.ReadJSON(w, r, &input)
@@ -24,82 +30,230 @@ func (app *app) createDiverHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Divers can only register themselves.
+	input.UserID = app.contextGetPrincipal(r).UserID
+
 	v := validator.New()
 	data.ValidateDiver(v, &input.Diver)
-	validator.ValidateEmail(v, input.Email)
 	if !v.Valid() {
 		app.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
 
 	// Call the User service to see if the given user has a valid account.
-	url := fmt.Sprintf("%s%s%s", app.cfg.svcUser.Addr, "/v1/user/email/", input.Email)
-	httpResp, res, err := jsonz.RequestJSend(http.MethodGet, url, 2*time.Second, nil)
+	user, err := app.users.GetByID(r.Context(), input.UserID)
 	if err != nil {
-		app.ServerErrorResponse(w, r, err)
-		return
-	}
-
-	// We received an error response, pass it upstream.
-	if res.Status == jsonz.JSendStatusError {
-		app.ServerErrorResponse(w, r, fmt.Errorf(res.Message))
-		return
-	}
-
-	// We received a fail response, pass it upstream.
-	if res.Status == jsonz.JSendStatusFail {
 		switch {
-		case httpResp.StatusCode == http.StatusNotFound:
+		case errors.Is(err, usersvc.ErrNotFound):
 			// We received a 404 error from the user service. So make the error
 			// message a bit more contextual and meaningful.
 			e := fmt.Sprint(
-				"Could not add diver as no active user account could be found for",
-				input.Email,
+				"Could not add diver as no active user account could be found for ",
+				input.UserID,
 			)
 			a := "Check a user account exists, has been activated and is not suspended or deleted"
 			data := map[string]string{"error": e, "action": a}
-			app.FailResponse(w, r, httpResp.StatusCode, data)
+			app.FailResponse(w, r, http.StatusNotFound, data)
 		default:
-			app.FailResponse(w, r, httpResp.StatusCode, res.Data)
+			app.userServiceErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// The JSend body contains a success Status, so use a second decoding pass
-	// to decode the JSend Data field into targetStruct.
-	userResp := &data.UserResponse{User: data.User{}}
-	err = jsonz.DecodeJSON(bytes.NewReader(res.Data), userResp, true)
+	// If the new diver was invited by another diver, check the invitation
+	// before creating anything so that a bad token can be corrected.
+	var inv *data.Invitation
+	var inviter *data.User
+	if input.InvitationToken != nil {
+		inv, inviter = app.readInvitation(w, r, "invitation_token", *input.InvitationToken, user)
+		if inv == nil {
+			return
+		}
+	}
+
+	err = app.models.Divers.Insert(r.Context(), &input.Diver)
 	if err != nil {
-		app.ServerErrorResponse(w, r, err)
+		var errUniqConstraint *sqldb.ErrUniqueConstraintViolation
+		switch {
+		case errors.As(err, &errUniqConstraint):
+			// The diver's user ID comes from their authentication token rather
+			// than a request field, so report the clash against the whole form.
+			v.AddError("form", "You are already registered as a diver")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
 		return
 	}
 
-	input.UserID = userResp.User.UserID
-	err = app.models.Divers.Insert(&input.Diver)
+	app.Logger.Info("New diver successfully registered", "diver", input.UserID)
+
+	// The diver has been registered successfully at this point, so a failure
+	// to redeem the invitation is only logged rather than failing the request.
+	if inv != nil {
+		err = app.redeemInvitation(r.Context(), inv, inviter, user)
+		if err != nil {
+			app.Logger.Error(err.Error(), "diver", input.UserID, "buddy", inv.BuddyID)
+		}
+	}
+
+	// Other divers may have already added the new diver as a buddy before they
+	// registered, so upgrade any of those buddy records to linked accounts.
+	app.Background(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), linkBuddiesTimeout)
+		defer cancel()
+
+		linked, skipped, err := app.models.Buddies.LinkByEmail(ctx, user.Email, input.UserID, user.Name)
+		if err != nil {
+			app.Logger.Error(err.Error(), "diver", input.UserID, "linked", linked,
+				"skipped", skipped)
+			return
+		}
+
+		app.Logger.Info("Existing buddies linked to new diver", "diver", input.UserID,
+			"linked", linked, "skipped", skipped)
+	})
+
+	du := data.NewDiverUser(user, &input.Diver)
+	err = jsonz.WriteJSendSuccess(w, http.StatusAccepted, nil, jsonz.Envelope{"diver": du})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readDiverUser reads the user ID URL parameter from the request, fetches the
+// matching Diver record from the database and the corresponding User from the
+// User service, and combines them into a DiverUser along with the diver's
+// average SAC rate. If either does not exist, or an error occurs, an
+// appropriate response is sent to the client and nil is returned.
+func (app *app) readDiverUser(w http.ResponseWriter, r *http.Request) *data.DiverUser {
+	v := validator.New()
+	userID := app.readUserIDParam(r, v)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return nil
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return nil
+	}
+
+	diver, err := app.models.Divers.GetByID(r.Context(), userID)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrDuplicateEmail):
-			v.AddError("email", "a diver with this email address already exists")
-			app.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
 		default:
 			app.ServerErrorResponse(w, r, err)
 		}
+		return nil
+	}
+
+	user := app.getUserByID(w, r, diver.UserID)
+	if user == nil {
+		return nil
+	}
+
+	du := data.NewDiverUser(user, diver)
+
+	du.SAC, err = app.models.Dives.GetAverageSAC(r.Context(), diver.UserID)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return nil
+	}
+
+	return du
+}
+
+// getUserByID calls the User service to get the base user details for the user
+// with the given ID. If the user cannot be found, or an error occurs, an
+// appropriate response is sent to the client and nil is returned.
+func (app *app) getUserByID(w http.ResponseWriter, r *http.Request, userID string) *data.User {
+	user, err := app.users.GetByID(r.Context(), userID)
+	if err != nil {
+		app.userServiceErrorResponse(w, r, err)
+		return nil
+	}
+
+	return user
+}
+
+func (app *app) fetchDiverHandler(w http.ResponseWriter, r *http.Request) {
+	du := app.readDiverUser(w, r)
+	if du == nil {
 		return
 	}
 
-	app.Logger.Info("New diver successfully registered", "diver", input.Email)
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"diver": du})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
 
-	du := data.DiverUser{
-		Email:        input.Email,
-		Name:         userResp.User.Name,
-		FriendlyName: userResp.User.FriendlyName,
-		BirthDate:    userResp.User.BirthDate,
-		Gender:       userResp.User.Gender,
-		CountryCode:  userResp.User.CountryCode,
-		TimeZone:     userResp.User.TimeZone,
-		Diver:        input.Diver,
+func (app *app) updateDiverHandler(w http.ResponseWriter, r *http.Request) {
+	du := app.readDiverUser(w, r)
+	if du == nil {
+		return
 	}
-	err = jsonz.WriteJSendSuccess(w, http.StatusAccepted, nil, jsonz.Envelope{"diver": du})
+
+	// Make sure that nobody else has changed the diver since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, du.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those. The base user fields belong to the User service
+	// and must be updated there.
+	var input struct {
+		DivingSince          *jsonz.DateOnly `json:"diving_since"`
+		DiveNumberOffset     *int            `json:"dive_number_offset"`
+		DefaultDivingCountry *string         `json:"default_diving_country"`
+		DefaultDivingTZ      *string         `json:"default_diving_timezone"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.DivingSince != nil {
+		du.DivingSince = input.DivingSince
+	}
+	if input.DiveNumberOffset != nil {
+		du.DiveNumberOffset = *input.DiveNumberOffset
+	}
+	if input.DefaultDivingCountry != nil {
+		du.DefaultDivingCountry = input.DefaultDivingCountry
+	}
+	if input.DefaultDivingTZ != nil {
+		du.DefaultDivingTZ = input.DefaultDivingTZ
+	}
+
+	v := validator.New()
+	data.ValidateDiver(v, &du.Diver)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Divers.Update(r.Context(), &du.Diver)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"diver": du})
 	if err != nil {
 		app.ServerErrorResponse(w, r, err)
 	}
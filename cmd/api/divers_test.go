@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+)
+
+func TestCreateDiverHandler(t *testing.T) {
+	diver := data.User{UserID: "u1", Email: "diver@example.com", Name: "Diver"}
+
+	tests := []struct {
+		name    string
+		userErr error
+		userID  string
+		body    any
+		status  int
+		dataKey string
+	}{
+		{
+			name:    "invalid diver",
+			userID:  "u1",
+			body:    map[string]any{"dive_number_offset": -1},
+			status:  http.StatusUnprocessableEntity,
+			dataKey: "dive_number_offset",
+		},
+		{
+			name:    "unknown field",
+			userID:  "u1",
+			body:    map[string]any{"depth": 30},
+			status:  http.StatusBadRequest,
+			dataKey: "error",
+		},
+		{
+			name:    "no active user account",
+			userID:  "u2",
+			body:    map[string]any{},
+			status:  http.StatusNotFound,
+			dataKey: "action",
+		},
+		{
+			name:   "user service rejects the lookup",
+			userID: "u1",
+			userErr: &usersvc.FailError{
+				StatusCode: http.StatusForbidden,
+				Data:       json.RawMessage(`{"error":"forbidden"}`),
+			},
+			body:    map[string]any{},
+			status:  http.StatusForbidden,
+			dataKey: "error",
+		},
+		{
+			name:    "user service unavailable",
+			userID:  "u1",
+			userErr: errors.New("connection refused"),
+			body:    map[string]any{},
+			status:  http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := usersvc.NewFake(diver)
+			users.Err = tt.userErr
+			app := newTestApp(t, users)
+
+			status, res := serve(t, app, http.HandlerFunc(app.createDiverHandler), http.MethodPost, tt.userID, "", tt.body)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.status, res)
+			}
+			if _, ok := res.Data[tt.dataKey]; tt.dataKey != "" && !ok {
+				t.Errorf("got data %v, want a %q key", res.Data, tt.dataKey)
+			}
+		})
+	}
+}
+
+// TestCreateDiverHandlerAuthentication checks that the diver is registered as
+// the user that the request's token belongs to in the User service.
+func TestCreateDiverHandlerAuthentication(t *testing.T) {
+	users := usersvc.NewFake(data.User{UserID: "u1", Email: "diver@example.com", Name: "Diver"})
+	users.AddToken("valid", "u1")
+	app := newTestApp(t, users)
+
+	h := app.authenticate(app.requireAuthenticatedUser(app.createDiverHandler))
+	body := map[string]any{"dive_number_offset": -1}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"unknown token", "invalid", http.StatusUnauthorized},
+		{"valid token", "valid", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, res := serve(t, app, h, http.MethodPost, "", tt.token, body)
+			if status != tt.status {
+				t.Errorf("got status %d, want %d: %+v", status, tt.status, res)
+			}
+		})
+	}
+
+	// Once the user's account has gone, their token no longer works.
+	users.Remove("u1")
+	if status, res := serve(t, app, h, http.MethodPost, "", "valid", body); status != http.StatusUnauthorized {
+		t.Errorf("got status %d for a removed user, want %d: %+v", status, http.StatusUnauthorized, res)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+func (app *app) createDiveHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		StartedAt  time.Time           `json:"started_at"`
+		Site       *string             `json:"site"`
+		SiteID     *int64              `json:"site_id"`
+		MaxDepth   float64             `json:"max_depth"`
+		BottomTime int                 `json:"bottom_time"`
+		WaterTemp  *float64            `json:"water_temperature"`
+		TripID     *int64              `json:"trip_id"`
+		BuddyIDs   []int64             `json:"buddy_ids"`
+		Cylinders  []data.DiveCylinder `json:"cylinders"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	dive := &data.Dive{
+		UserID:     app.contextGetPrincipal(r).UserID,
+		StartedAt:  input.StartedAt,
+		Site:       input.Site,
+		SiteID:     input.SiteID,
+		MaxDepth:   input.MaxDepth,
+		BottomTime: input.BottomTime,
+		WaterTemp:  input.WaterTemp,
+		TripID:     input.TripID,
+		BuddyIDs:   input.BuddyIDs,
+		Cylinders:  input.Cylinders,
+	}
+
+	if dive.BuddyIDs == nil {
+		dive.BuddyIDs = []int64{}
+	}
+	if dive.Cylinders == nil {
+		dive.Cylinders = []data.DiveCylinder{}
+	}
+
+	v := validator.New()
+
+	data.ValidateDive(v, dive)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Dives can only be logged by registered divers.
+	_, err = app.models.Divers.GetByID(r.Context(), dive.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Dives.Insert(r.Context(), dive)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("New dive successfully logged", "user", dive.UserID,
+		"dive", dive.ID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/dive/id/%d", dive.ID))
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, headers, jsonz.Envelope{"dive": dive})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readDiveParam reads the dive ID URL parameter from the request and fetches
+// the matching Dive from the database. If it does not exist, does not belong
+// to the authenticated user or the parameter is invalid, an appropriate
+// response will be sent and nil will be returned.
+func (app *app) readDiveParam(w http.ResponseWriter, r *http.Request) *data.Dive {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	dive, err := app.models.Dives.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	// Don't reveal that other divers' dives exist.
+	if dive.UserID != app.contextGetPrincipal(r).UserID {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	return dive
+}
+
+func (app *app) fetchDiveHandler(w http.ResponseWriter, r *http.Request) {
+	dive := app.readDiveParam(w, r)
+	if dive == nil {
+		return
+	}
+
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"dive": dive})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listDivesHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	userID := app.readUserIDParam(r, v)
+	filters := app.readFilters(qs, v, "-started_at", "started_at", "number", "max_depth", "bottom_time")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	dives, metadata, err := app.models.Dives.GetAllForDiver(r.Context(), userID, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"dives": dives, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateDiveHandler(w http.ResponseWriter, r *http.Request) {
+	dive := app.readDiveParam(w, r)
+	if dive == nil {
+		return
+	}
+
+	// Make sure that nobody else has changed the dive since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, dive.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those. The optional fields can also be cleared by setting
+	// them to null, so need to tell a null apart from an omitted field.
+	var input struct {
+		StartedAt  *time.Time           `json:"started_at"`
+		Site       nullable[string]     `json:"site"`
+		SiteID     nullable[int64]      `json:"site_id"`
+		MaxDepth   *float64             `json:"max_depth"`
+		BottomTime *int                 `json:"bottom_time"`
+		WaterTemp  nullable[float64]    `json:"water_temperature"`
+		TripID     nullable[int64]      `json:"trip_id"`
+		BuddyIDs   *[]int64             `json:"buddy_ids"`
+		Cylinders  *[]data.DiveCylinder `json:"cylinders"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.StartedAt != nil {
+		dive.StartedAt = *input.StartedAt
+	}
+	if input.Site.Set {
+		dive.Site = input.Site.Value
+	}
+	if input.SiteID.Set {
+		dive.SiteID = input.SiteID.Value
+	}
+	if input.MaxDepth != nil {
+		dive.MaxDepth = *input.MaxDepth
+	}
+	if input.BottomTime != nil {
+		dive.BottomTime = *input.BottomTime
+	}
+	if input.WaterTemp.Set {
+		dive.WaterTemp = input.WaterTemp.Value
+	}
+	if input.TripID.Set {
+		dive.TripID = input.TripID.Value
+	}
+	if input.BuddyIDs != nil {
+		dive.BuddyIDs = *input.BuddyIDs
+	}
+	if input.Cylinders != nil {
+		dive.Cylinders = *input.Cylinders
+	}
+
+	if dive.BuddyIDs == nil {
+		dive.BuddyIDs = []int64{}
+	}
+	if dive.Cylinders == nil {
+		dive.Cylinders = []data.DiveCylinder{}
+	}
+
+	v := validator.New()
+
+	data.ValidateDive(v, dive)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Dives.Update(r.Context(), dive)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"dive": dive})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) deleteDiveHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Dives.Delete(r.Context(), app.contextGetPrincipal(r).UserID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Dive successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/deco"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+const (
+	// feetPerMetre converts depths between metric and imperial units.
+	feetPerMetre = 3.28084
+	// defaultMaxPPO2 is the partial pressure of oxygen that gases are limited
+	// to while working at depth if no other limit is given.
+	defaultMaxPPO2 = 1.4
+	// hypoxicO2 is the fraction of oxygen below which a gas cannot safely be
+	// breathed at the surface.
+	hypoxicO2 = 0.16
+)
+
+// gasDepth is a depth given in both metres and feet.
+type gasDepth struct {
+	Metres float64 `json:"metres"`
+	Feet   float64 `json:"feet"`
+}
+
+// newGasDepth returns the given depth in metres as a gasDepth, rounded to one
+// decimal place. Limits are rounded down and other depths are rounded up, so
+// that the rounding is always on the safe side.
+func newGasDepth(metres float64, limit bool) gasDepth {
+	round := math.Ceil
+	if limit {
+		round = math.Floor
+	}
+
+	return gasDepth{
+		Metres: round(metres*10) / 10,
+		Feet:   round(metres*feetPerMetre*10) / 10,
+	}
+}
+
+// gasMix describes a breathing gas. The O2 and He fields are percentages.
+type gasMix struct {
+	Name string  `json:"name"`
+	O2   float64 `json:"o2"`
+	He   float64 `json:"he"`
+}
+
+func newGasMix(g deco.Gas) gasMix {
+	return gasMix{
+		Name: g.String(),
+		O2:   math.Round(g.O2*1000) / 10,
+		He:   math.Round(g.He*1000) / 10,
+	}
+}
+
+// gasInput is a breathing gas given by a client. The O2 and He fields are
+// percentages.
+type gasInput struct {
+	O2 float64 `json:"o2"`
+	He float64 `json:"he"`
+}
+
+func (g gasInput) gas() deco.Gas {
+	return deco.Gas{O2: g.O2 / 100, He: g.He / 100}
+}
+
+// validateGas checks the given percentages of oxygen and helium and stores any
+// errors in v under the given key.
+func validateGas(v *validator.Validator, key string, o2, he float64) {
+	v.Check(o2 >= 1 && o2 <= 100, key, "Must have an O2 percentage between 1 and 100")
+	v.Check(he >= 0 && he <= 99, key, "Must have an He percentage between 0 and 99")
+	v.Check(o2+he <= 100, key, "Must not have more than 100% O2 and He combined")
+}
+
+// readGas reads a breathing gas from the o2 and he query string parameters,
+// which are percentages. The o2 parameter is required and he defaults to zero.
+func (app *app) readGas(qs url.Values, v *validator.Validator) deco.Gas {
+	var input gasInput
+
+	o2 := app.readFloat(qs, "o2", v)
+	if o2 == nil {
+		v.AddError("o2", "Must be provided")
+	} else {
+		input.O2 = *o2
+	}
+	if he := app.readFloat(qs, "he", v); he != nil {
+		input.He = *he
+	}
+
+	validateGas(v, "gas", input.O2, input.He)
+
+	return input.gas()
+}
+
+// readDepth reads a required depth in metres from the given query string
+// parameter.
+func (app *app) readDepth(qs url.Values, key string, v *validator.Validator) float64 {
+	depth := app.readFloat(qs, key, v)
+	if depth == nil {
+		v.AddError(key, "Must be provided")
+		return 0
+	}
+
+	v.Check(*depth >= 0 && *depth <= 150, key, "Must be between 0 and 150 metres")
+
+	return *depth
+}
+
+// readPPO2 reads the ppo2 query string parameter, which is a limit on the
+// partial pressure of oxygen in bar, or returns defaultMaxPPO2.
+func (app *app) readPPO2(qs url.Values, v *validator.Validator) float64 {
+	ppo2 := defaultMaxPPO2
+	if p := app.readFloat(qs, "ppo2", v); p != nil {
+		ppo2 = *p
+	}
+
+	v.Check(ppo2 >= 0.16 && ppo2 <= 2, "ppo2", "Must be between 0.16 and 2.0 bar")
+
+	return ppo2
+}
+
+// readO2Narcotic reads the o2_narcotic query string parameter, which says
+// whether oxygen is taken to be narcotic. It defaults to true.
+func (app *app) readO2Narcotic(qs url.Values, v *validator.Validator) bool {
+	if narcotic := app.readBool(qs, "o2_narcotic", v); narcotic != nil {
+		return *narcotic
+	}
+
+	return true
+}
+
+func (app *app) gasMODHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	gas := app.readGas(qs, v)
+	ppo2 := app.readPPO2(qs, v)
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := jsonz.Envelope{
+		"gas":  newGasMix(gas),
+		"ppo2": ppo2,
+		"mod":  newGasDepth(gas.MOD(ppo2), true),
+	}
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) gasEADHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	gas := app.readGas(qs, v)
+	depth := app.readDepth(qs, "depth", v)
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := jsonz.Envelope{
+		"gas":   newGasMix(gas),
+		"depth": newGasDepth(depth, false),
+		"ead":   newGasDepth(gas.EAD(depth), false),
+	}
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) gasENDHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	gas := app.readGas(qs, v)
+	depth := app.readDepth(qs, "depth", v)
+	o2Narcotic := app.readO2Narcotic(qs, v)
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := jsonz.Envelope{
+		"gas":         newGasMix(gas),
+		"depth":       newGasDepth(depth, false),
+		"o2_narcotic": o2Narcotic,
+		"end":         newGasDepth(gas.END(depth, o2Narcotic), false),
+	}
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) gasBestMixHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	depth := app.readDepth(qs, "depth", v)
+	ppo2 := app.readPPO2(qs, v)
+	o2Narcotic := app.readO2Narcotic(qs, v)
+
+	// Without a limit on the equivalent narcotic depth, the best nitrox mix is
+	// found.
+	maxEND := app.readFloat(qs, "end", v)
+	if maxEND != nil {
+		v.Check(*maxEND >= 0 && *maxEND <= 60, "end", "Must be between 0 and 60 metres")
+	}
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	gas, err := deco.BestMix(depth, ppo2, maxEND, o2Narcotic)
+	if err != nil {
+		switch {
+		case errors.Is(err, deco.ErrNoMix):
+			v.AddError("depth", "No mix meets both the ppO2 and END limits at this depth")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := jsonz.Envelope{
+		"gas":         newGasMix(gas),
+		"depth":       newGasDepth(depth, false),
+		"ppo2":        ppo2,
+		"o2_narcotic": o2Narcotic,
+		"mod":         newGasDepth(gas.MOD(ppo2), true),
+		"end":         newGasDepth(gas.END(depth, o2Narcotic), false),
+		"hypoxic":     gas.O2 < hypoxicO2,
+	}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) gasBlendHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Current struct {
+			Pressure float64 `json:"pressure"`
+			gasInput
+		} `json:"current"`
+		Target struct {
+			Pressure float64 `json:"pressure"`
+			gasInput
+		} `json:"target"`
+		TopUp *gasInput `json:"top_up"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	// Cylinders are usually topped up with air.
+	topUp := gasInput{O2: 21}
+	if input.TopUp != nil {
+		topUp = *input.TopUp
+	}
+
+	v := validator.New()
+
+	v.Check(input.Current.Pressure >= 0 && input.Current.Pressure <= 300, "current",
+		"Must have a pressure between 0 and 300 bar")
+	if input.Current.Pressure > 0 {
+		validateGas(v, "current", input.Current.O2, input.Current.He)
+	}
+
+	v.Check(input.Target.Pressure > 0 && input.Target.Pressure <= 300, "target",
+		"Must have a pressure between 0 and 300 bar")
+	validateGas(v, "target", input.Target.O2, input.Target.He)
+
+	validateGas(v, "top_up", topUp.O2, topUp.He)
+	v.Check(topUp.O2+topUp.He < 100, "top_up", "Must contain some nitrogen")
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	current := deco.Fill{Pressure: input.Current.Pressure, Gas: input.Current.gas()}
+	target := deco.Fill{Pressure: input.Target.Pressure, Gas: input.Target.gas()}
+
+	steps, err := deco.Blend(current, target, topUp.gas())
+	if err != nil {
+		switch {
+		case errors.Is(err, deco.ErrCannotBlend):
+			v.AddError("target", "Cannot be blended from the current fill with the top-up gas")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	type blendStep struct {
+		Kind     string  `json:"kind"`
+		Gas      *gasMix `json:"gas,omitempty"`
+		Change   float64 `json:"change"`
+		Pressure float64 `json:"pressure"`
+	}
+
+	out := make([]blendStep, 0, len(steps))
+	for _, step := range steps {
+		bs := blendStep{
+			Kind:     step.Kind,
+			Change:   math.Round(step.Change*10) / 10,
+			Pressure: math.Round(step.Pressure*10) / 10,
+		}
+		if step.Kind != deco.BlendDrain {
+			mix := newGasMix(step.Gas)
+			bs.Gas = &mix
+		}
+		out = append(out, bs)
+	}
+
+	env := jsonz.Envelope{
+		"target": newGasMix(target.Gas),
+		"steps":  out,
+	}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, env)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
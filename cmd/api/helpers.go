@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// nullable is a field of a JSON request body that the client may omit, give a
+// value or explicitly set to null, such as an optional field in a PATCH request
+// that can be cleared. Set reports whether the field was present at all, and
+// Value is nil if it was null.
+type nullable[T any] struct {
+	Set   bool
+	Value *T
+}
+
+// UnmarshalJSON implements the encoding/json.Unmarshaler interface. It is only
+// called for fields that are present in the JSON, including as null.
+func (n *nullable[T]) UnmarshalJSON(b []byte) error {
+	n.Set = true
+	n.Value = nil
+
+	return json.Unmarshal(b, &n.Value)
+}
+
+// readNamedIDParam reads the named URL parameter from the request and parses it
+// as a positive int64 ID. It behaves the same way as ReadIDParam, but for URL
+// parameters other than "id".
+func (app *app) readNamedIDParam(r *http.Request, name string) (int64, error) {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s parameter", name)
+	}
+
+	return id, nil
+}
+
+// readUserIDParam reads the "id" URL parameter from the request, which is
+// expected to be a user ID in the BetterGUID format. If it is not, an error is
+// added to the validator.Validator v.
+func (app *app) readUserIDParam(r *http.Request, v *validator.Validator) string {
+	params := httprouter.ParamsFromContext(r.Context())
+	userID := params.ByName("id")
+
+	v.Check(validator.Matches(userID, validator.BetterGUIDRX),
+		"user-id", "must be a valid BetterGUID")
+
+	return userID
+}
+
+// readBool reads the given key from the query string and parses it as a
+// boolean. If the key is not present, nil is returned. If the value cannot be
+// parsed, an error is added to the validator.Validator v.
+func (app *app) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "Must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
+// readFloat reads the given key from the query string and parses it as a
+// float64. If the key is not present, nil is returned. If the value cannot be
+// parsed, an error is added to the validator.Validator v.
+func (app *app) readFloat(qs url.Values, key string, v *validator.Validator) *float64 {
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		v.AddError(key, "Must be a number")
+		return nil
+	}
+
+	return &f
+}
+
+// readFilters reads the page, page_size and sort parameters from the query
+// string into a data.Filters struct and validates them, adding any errors to
+// the validator.Validator v. The sort parameter must be one of the given
+// safelist of column names, each of which may also be given with a "-" prefix
+// to sort in descending order.
+func (app *app) readFilters(qs url.Values, v *validator.Validator, defaultSort string, safelist ...string) data.Filters {
+	filters := data.Filters{
+		Page:     app.ReadInt(qs, "page", 1, v),
+		PageSize: app.ReadInt(qs, "page_size", 20, v),
+		Sort:     app.ReadString(qs, "sort", defaultSort),
+	}
+
+	for _, column := range safelist {
+		filters.SortSafelist = append(filters.SortSafelist, column, "-"+column)
+	}
+
+	data.ValidateFilters(v, filters)
+
+	return filters
+}
+
+// requireExpectedVersion checks the X-Expected-Version header, which the
+// client must send with the version of the record that its changes are based
+// on, against the given version of the record. If the header is missing or is
+// not a valid version, a 422 Unprocessable Entity response is sent to the
+// client. If it does not match, someone else has changed the record in the
+// meantime and a 409 Conflict response is sent. In either case, false is
+// returned.
+func (app *app) requireExpectedVersion(w http.ResponseWriter, r *http.Request, version int) bool {
+	v := validator.New()
+
+	header := r.Header.Get("X-Expected-Version")
+	expected, err := strconv.Atoi(header)
+	v.Check(header != "", "X-Expected-Version", "Must be provided")
+	v.Check(header == "" || (err == nil && expected > 0), "X-Expected-Version", "Must be a positive integer")
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	if expected != version {
+		app.EditConflictResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// requireActingUser checks that the authenticated user making the request may
+// act as the diver with the given user ID, which is typically read from the
+// URL. If they may not, a 403 Forbidden response is sent to the client and
+// false is returned.
+func (app *app) requireActingUser(w http.ResponseWriter, r *http.Request, userID string) bool {
+	if !auth.CanActAsDiver(app.contextGetPrincipal(r), userID) {
+		app.NotPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// diverRequiredResponse sends a 403 Forbidden response to the client to say
+// that the requested action is only available to registered divers.
+func (app *app) diverRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	data := map[string]string{
+		"error":  "You must be registered as a diver to access this resource",
+		"action": "Register as a diver and then try again",
+	}
+	app.FailResponse(w, r, http.StatusForbidden, data)
+}
+
+// recordInUseResponse sends a 409 Conflict response to the client to say that
+// the requested resource cannot be deleted because other records depend on it.
+func (app *app) recordInUseResponse(w http.ResponseWriter, r *http.Request) {
+	data := map[string]string{
+		"error":  "The resource cannot be deleted as it is still in use by other records",
+		"action": "Remove the records that depend on this resource and then try again",
+	}
+	app.FailResponse(w, r, http.StatusConflict, data)
+}
+
+// userServiceErrorResponse sends an appropriate response to the client for an
+// error returned by the User service client. Fail responses from the User
+// service are passed on to the client as they are.
+func (app *app) userServiceErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var failErr *usersvc.FailError
+
+	switch {
+	case errors.Is(err, usersvc.ErrNotFound):
+		app.NotFoundResponse(w, r)
+	case errors.As(err, &failErr):
+		app.FailResponse(w, r, failErr.StatusCode, failErr.Data)
+	case errors.Is(err, usersvc.ErrCircuitOpen):
+		app.userServiceUnavailableResponse(w, r)
+	default:
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// userServiceUnavailableResponse sends a 503 Service Unavailable response to
+// the client while the User service client's circuit breaker is open, telling
+// them to retry once the breaker's cooldown has passed.
+func (app *app) userServiceUnavailableResponse(w http.ResponseWriter, r *http.Request) {
+	retryAfter := max(int(math.Ceil(app.cfg.usersvc.BreakerCooldown.Seconds())), 1)
+	headers := http.Header{"Retry-After": []string{strconv.Itoa(retryAfter)}}
+
+	msg := "The user service is temporarily unavailable, please try again later"
+	err := jsonz.WriteJSendError(w, http.StatusServiceUnavailable, headers, msg, nil, nil)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// constraintViolationResponse sends a failed validation response to the client
+// describing which field or fields broke a database constraint. If err is not
+// one of the typed constraint violation errors from the data package, false is
+// returned and no response is sent.
+func (app *app) constraintViolationResponse(w http.ResponseWriter, r *http.Request, err error) bool {
+	var (
+		errUniqConstraint *sqldb.ErrUniqueConstraintViolation
+		errForeignKey     *data.ErrForeignKeyViolation
+		errCheck          *data.ErrCheckViolation
+		errNotNull        *data.ErrNotNullViolation
+	)
+
+	// The message is used for a single offending field and the form message for
+	// zero or several, in which case the columns are appended to it.
+	var cols []string
+	var msg, formMsg string
+
+	switch {
+	case errors.As(err, &errUniqConstraint):
+		cols, msg, formMsg = errUniqConstraint.Columns,
+			"A record already exists for this value", "A record already exists for the values"
+	case errors.As(err, &errForeignKey):
+		cols, msg, formMsg = errForeignKey.Columns,
+			"Must refer to an existing record", "No existing record matches the values"
+	case errors.As(err, &errCheck):
+		cols, msg, formMsg = errCheck.Columns,
+			"Is not a permitted value", "The values are not permitted"
+	case errors.As(err, &errNotNull):
+		cols, msg = []string{errNotNull.Column}, "Must be provided"
+	default:
+		return false
+	}
+
+	e := make(map[string]string)
+	switch len(cols) {
+	case 0:
+		e["form"] = formMsg
+	case 1:
+		e[cols[0]] = msg
+	default:
+		e["form"] = fmt.Sprintf("%s %v", formMsg, strings.Join(cols, ", "))
+	}
+	app.FailedValidationResponse(w, r, e)
+
+	return true
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestNullable(t *testing.T) {
+	tests := []struct {
+		name  string
+		body  string
+		set   bool
+		value any
+	}{
+		{"omitted", `{}`, false, nil},
+		{"null", `{"trip_id": null}`, true, nil},
+		{"value", `{"trip_id": 3}`, true, int64(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input struct {
+				TripID nullable[int64] `json:"trip_id"`
+			}
+
+			err := json.Unmarshal([]byte(tt.body), &input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if input.TripID.Set != tt.set {
+				t.Errorf("got Set %t, want %t", input.TripID.Set, tt.set)
+			}
+
+			var value any
+			if input.TripID.Value != nil {
+				value = *input.TripID.Value
+			}
+			if value != tt.value {
+				t.Errorf("got value %v, want %v", value, tt.value)
+			}
+		})
+	}
+
+	var input struct {
+		TripID nullable[int64] `json:"trip_id"`
+	}
+	err := json.Unmarshal([]byte(`{"trip_id": "3"}`), &input)
+	if err == nil {
+		t.Error("got no error for a value of the wrong type")
+	}
+}
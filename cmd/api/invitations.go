@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// readInvitation validates the given plaintext invitation token for the given
+// user, fetches the matching Invitation from the database and gets the details
+// of the diver who created it from the User service. The key is the name of the
+// request field that the token was read from. Invitations can only be redeemed
+// by the user whose email address they were sent to, so that nobody else who
+// gets hold of the token can take over the inviter's buddy record. If the token
+// is invalid, has expired or is for someone else, or an error occurs, an
+// appropriate response is sent to the client and nil values are returned.
+func (app *app) readInvitation(w http.ResponseWriter, r *http.Request, key, token string, user *data.User) (*data.Invitation, *data.User) {
+	v := validator.New()
+	data.ValidateInvitationToken(v, key, token)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return nil, nil
+	}
+
+	inv, err := app.models.Invitations.GetByToken(r.Context(), token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError(key, "Invalid or expired invitation token")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil, nil
+	}
+
+	if !strings.EqualFold(user.Email, inv.Email) {
+		v.AddError(key, "Was not sent to your email address")
+		app.FailedValidationResponse(w, r, v.Errors)
+		return nil, nil
+	}
+
+	inviter := app.getUserByID(w, r, inv.UserID)
+	if inviter == nil {
+		return nil, nil
+	}
+
+	return inv, inviter
+}
+
+// redeemInvitation redeems the given Invitation created by inviter on behalf of
+// the registered diver user, making them accepted buddies of each other.
+func (app *app) redeemInvitation(ctx context.Context, inv *data.Invitation, inviter, user *data.User) error {
+	status := data.BuddyStatusAccepted
+	reciprocal := &data.Buddy{
+		UserID:      user.UserID,
+		BuddyUserID: &inviter.UserID,
+		Name:        inviter.Name,
+		Email:       &inviter.Email,
+		Status:      &status,
+	}
+
+	err := app.models.Invitations.Redeem(ctx, inv, user.UserID, user.Name, reciprocal)
+	if err != nil {
+		return err
+	}
+
+	app.Logger.Info("Buddy invitation redeemed", "user", user.UserID,
+		"inviter", inviter.UserID, "buddy", inv.BuddyID)
+
+	return nil
+}
+
+func (app *app) redeemInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	userID := app.contextGetPrincipal(r).UserID
+
+	// Only registered divers can redeem an invitation.
+	_, err = app.models.Divers.GetByID(r.Context(), userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.getUserByID(w, r, userID)
+	if user == nil {
+		return
+	}
+
+	inv, inviter := app.readInvitation(w, r, "token", input.Token, user)
+	if inv == nil {
+		return
+	}
+
+	v := validator.New()
+	if inviter.UserID == userID {
+		v.AddError("token", "Must not be your own invitation")
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.redeemInvitation(r.Context(), inv, inviter, user)
+	if err != nil {
+		var errUniqConstraint *sqldb.ErrUniqueConstraintViolation
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "Invalid or expired invitation token")
+			app.FailedValidationResponse(w, r, v.Errors)
+		case errors.As(err, &errUniqConstraint):
+			v.AddError("token", "You already have a buddy record for the inviter")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Invitation successfully redeemed"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
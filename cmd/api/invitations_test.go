@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql/driver"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+)
+
+const testInvitationToken = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// newInvitationTestUsers returns a Fake with the inviter u1, the buddy u2 that
+// they invited by email address and an unrelated user u3.
+func newInvitationTestUsers() *usersvc.Fake {
+	return usersvc.NewFake(
+		data.User{UserID: "u1", Email: "diver@example.com", Name: "Diver"},
+		data.User{UserID: "u2", Email: "buddy@example.com", Name: "Buddy"},
+		data.User{UserID: "u3", Email: "other@example.com", Name: "Other"},
+	)
+}
+
+// invitationQuery answers the lookup of an invitation that u1 sent to
+// BUDDY@example.com for their buddy record 7.
+var invitationQuery = testQuery{
+	match: "from buddy_invitations",
+	rows: [][]driver.Value{
+		{[]byte("hash"), int64(7), "u1", "BUDDY@example.com", time.Now().Add(time.Hour)},
+	},
+}
+
+// diverQuery answers the lookup of a registered diver with the given user ID.
+func diverQuery(userID string) testQuery {
+	return testQuery{
+		match: "from divers",
+		rows:  [][]driver.Value{{userID, int64(1), nil, int64(0), nil, nil}},
+	}
+}
+
+func TestRedeemInvitationHandler(t *testing.T) {
+	redeemQueries := []testQuery{
+		{match: "update buddies", rowsAffected: 1},
+		{match: "insert into buddies", rows: [][]driver.Value{{int64(8), int64(1), time.Now(), time.Now()}}},
+		{match: "delete from buddy_invitations", rowsAffected: 1},
+	}
+
+	tests := []struct {
+		name    string
+		userID  string
+		queries []testQuery
+		status  int
+		dataKey string
+	}{
+		{
+			name:    "invited user",
+			userID:  "u2",
+			queries: append(redeemQueries, diverQuery("u2"), invitationQuery),
+			status:  http.StatusOK,
+			dataKey: "message",
+		},
+		{
+			// The redeeming statements are not expected, so the test fails if
+			// the invitation is redeemed.
+			name:    "another user",
+			userID:  "u3",
+			queries: []testQuery{diverQuery("u3"), invitationQuery},
+			status:  http.StatusUnprocessableEntity,
+			dataKey: "token",
+		},
+		{
+			name:    "not a diver",
+			userID:  "u2",
+			queries: []testQuery{{match: "from divers"}},
+			status:  http.StatusForbidden,
+			dataKey: "action",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newTestApp(t, newInvitationTestUsers(), tt.queries...)
+
+			body := map[string]any{"token": testInvitationToken}
+			status, res := serve(t, app, http.HandlerFunc(app.redeemInvitationHandler), http.MethodPost, tt.userID, "", body)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d: %+v", status, tt.status, res)
+			}
+			if _, ok := res.Data[tt.dataKey]; tt.dataKey != "" && !ok {
+				t.Errorf("got data %v, want a %q key", res.Data, tt.dataKey)
+			}
+		})
+	}
+}
+
+// TestCreateDiverHandlerInvitation checks that a new diver cannot register with
+// an invitation that was sent to somebody else, and that nothing is created
+// when they try.
+func TestCreateDiverHandlerInvitation(t *testing.T) {
+	app := newTestApp(t, newInvitationTestUsers(), invitationQuery)
+
+	body := map[string]any{"invitation_token": testInvitationToken}
+	status, res := serve(t, app, http.HandlerFunc(app.createDiverHandler), http.MethodPost, "u3", "", body)
+	if status != http.StatusUnprocessableEntity {
+		t.Fatalf("got status %d, want %d: %+v", status, http.StatusUnprocessableEntity, res)
+	}
+	if _, ok := res.Data["invitation_token"]; !ok {
+		t.Errorf("got data %v, want an %q key", res.Data, "invitation_token")
+	}
+}
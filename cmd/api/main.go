@@ -4,9 +4,12 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
 	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
 	"github.com/m5lapp/go-service-toolkit/config"
 	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
 	"github.com/m5lapp/go-service-toolkit/vcs"
@@ -15,14 +18,20 @@ import (
 )
 
 type appConfig struct {
-	db      config.SqlDB
-	svcUser config.Service
+	auth          auth.Config
+	db            config.SqlDB
+	dbTimeouts    data.Timeouts
+	svcUser       config.Service
+	usersvc       usersvc.Config
+	invitationTTL time.Duration
 }
 
 type app struct {
 	webapp.WebApp
 	cfg    appConfig
+	auth   auth.Authenticator
 	models data.Models
+	users  usersvc.Client
 }
 
 func main() {
@@ -31,7 +40,16 @@ func main() {
 
 	serverCfg.Flags(":8080")
 	appCfg.db.Flags("postgres", 25, 25, "15m")
+	flag.DurationVar(&appCfg.dbTimeouts.Read, "db-read-timeout", 3*time.Second,
+		"Maximum time a database read query may take (time.Duration)")
+	flag.DurationVar(&appCfg.dbTimeouts.Write, "db-write-timeout", 5*time.Second,
+		"Maximum time a database write or transaction may take (time.Duration)")
 	appCfg.svcUser.Flags("user-service-address", "HTTP address of the user service")
+	appCfg.usersvc.Flags()
+	appCfg.auth.Flags()
+
+	flag.DurationVar(&appCfg.invitationTTL, "buddy-invitation-ttl", 7*24*time.Hour,
+		"How long buddy invitation tokens remain valid for (time.Duration)")
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
@@ -53,10 +71,24 @@ func main() {
 
 	logger.Info("Database connection pool established")
 
+	users, err := usersvc.NewHTTPClient(appCfg.svcUser.Addr, appCfg.usersvc, logger)
+	if err != nil {
+		logger.Error(err.Error(), nil)
+		os.Exit(1)
+	}
+
+	authenticator, err := auth.New(appCfg.auth, users, logger)
+	if err != nil {
+		logger.Error(err.Error(), nil)
+		os.Exit(1)
+	}
+
 	app := &app{
 		WebApp: webapp.New(serverCfg, logger),
 		cfg:    appCfg,
-		models: data.NewModels(db),
+		auth:   authenticator,
+		models: data.NewModels(db, appCfg.dbTimeouts),
+		users:  users,
 	}
 
 	err = app.Serve(app.routes())
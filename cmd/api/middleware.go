@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+)
+
+// authenticate checks the bearer token in the Authorization header of the
+// request, if there is one, and adds the Principal that it belongs to to the
+// request context. Requests without an Authorization header are given the
+// AnonymousPrincipal so that public endpoints still work.
+func (app *app) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Authorization")
+
+		authorizationHeader := r.Header.Get("Authorization")
+		if authorizationHeader == "" {
+			r = app.contextSetPrincipal(r, auth.AnonymousPrincipal)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		headerParts := strings.Split(authorizationHeader, " ")
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+			app.InvalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		principal, err := app.auth.Authenticate(r.Context(), headerParts[1])
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidToken):
+				app.InvalidAuthenticationTokenResponse(w, r)
+			default:
+				app.userServiceErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetPrincipal(r, principal)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireAuthenticatedUser only lets the request through to the next handler if
+// it was made by an authenticated user.
+func (app *app) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal := app.contextGetPrincipal(r)
+
+		if principal.IsAnonymous() {
+			app.AuthenticationRequiredResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requirePermission only lets the request through to the next handler if it
+// was made by an authenticated user that the given policy allows.
+func (app *app) requirePermission(policy auth.Policy, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		principal := app.contextGetPrincipal(r)
+
+		if !policy(principal) {
+			app.NotPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+
+	return app.requireAuthenticatedUser(fn)
+}
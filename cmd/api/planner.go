@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/deco"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+const (
+	// defaultPlannerSAC is the SAC rate in litres per minute used to plan dives
+	// for divers who have not logged enough details to work out their own.
+	defaultPlannerSAC = 20.0
+	// maxBottomPPO2 is the highest partial pressure of oxygen that is
+	// recommended while working at depth.
+	maxBottomPPO2 = 1.4
+)
+
+// The sources of the SAC rate used to plan a dive.
+const (
+	sacSourceRequest = "request"
+	sacSourceDiver   = "diver"
+	sacSourceDefault = "default"
+)
+
+type plannedStop struct {
+	Depth    float64 `json:"depth"`
+	Minutes  int     `json:"minutes"`
+	Runtime  float64 `json:"runtime"`
+	Cylinder int     `json:"cylinder"`
+	Gas      string  `json:"gas"`
+}
+
+type plannedSegment struct {
+	Kind       string  `json:"kind"`
+	StartDepth float64 `json:"start_depth"`
+	EndDepth   float64 `json:"end_depth"`
+	Minutes    float64 `json:"minutes"`
+	Runtime    float64 `json:"runtime"`
+	Cylinder   int     `json:"cylinder"`
+	Gas        string  `json:"gas"`
+}
+
+// plannedGas is the gas that a planned dive uses from a single cylinder. The
+// pressure used and the pressure left are only given if the cylinder's size
+// and start pressure are known.
+type plannedGas struct {
+	Cylinder     int      `json:"cylinder"`
+	Gas          string   `json:"gas"`
+	Litres       float64  `json:"litres"`
+	CubicFeet    float64  `json:"cubic_feet"`
+	PressureUsed *float64 `json:"pressure_used,omitempty"`
+	EndPressure  *float64 `json:"end_pressure,omitempty"`
+}
+
+type plannedSAC struct {
+	data.SACRate
+	Source string `json:"source"`
+}
+
+type plannedDive struct {
+	Runtime  float64          `json:"runtime"`
+	DecoTime int              `json:"deco_time"`
+	Stops    []plannedStop    `json:"stops"`
+	Segments []plannedSegment `json:"segments"`
+	Gas      []plannedGas     `json:"gas"`
+	SAC      plannedSAC       `json:"sac"`
+	CNS      float64          `json:"cns"`
+	OTU      float64          `json:"otu"`
+	GFLow    int              `json:"gf_low"`
+	GFHigh   int              `json:"gf_high"`
+	Warnings []string         `json:"warnings"`
+}
+
+func (app *app) planDiveHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Levels []struct {
+			Depth    float64 `json:"depth"`
+			Minutes  float64 `json:"minutes"`
+			Cylinder int     `json:"cylinder"`
+		} `json:"levels"`
+		Cylinders   []data.DiveCylinder `json:"cylinders"`
+		GFLow       *int                `json:"gf_low"`
+		GFHigh      *int                `json:"gf_high"`
+		DescentRate *float64            `json:"descent_rate"`
+		AscentRate  *float64            `json:"ascent_rate"`
+		LastStop    *float64            `json:"last_stop"`
+		MaxDecoPPO2 *float64            `json:"max_deco_ppo2"`
+		SAC         *float64            `json:"sac"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	// Gradient factors of 30/70 are a common conservative default.
+	gfLow, gfHigh := 30, 70
+	if input.GFLow != nil {
+		gfLow = *input.GFLow
+	}
+	if input.GFHigh != nil {
+		gfHigh = *input.GFHigh
+	}
+
+	plan := deco.Plan{
+		GFLow:       float64(gfLow) / 100,
+		GFHigh:      float64(gfHigh) / 100,
+		DescentRate: deco.DefaultDescentRate,
+		AscentRate:  deco.DefaultAscentRate,
+		LastStop:    deco.DefaultLastStop,
+		MaxDecoPPO2: deco.DefaultMaxDecoPPO2,
+	}
+	if input.DescentRate != nil {
+		plan.DescentRate = *input.DescentRate
+	}
+	if input.AscentRate != nil {
+		plan.AscentRate = *input.AscentRate
+	}
+	if input.LastStop != nil {
+		plan.LastStop = *input.LastStop
+	}
+	if input.MaxDecoPPO2 != nil {
+		plan.MaxDecoPPO2 = *input.MaxDecoPPO2
+	}
+
+	v := validator.New()
+
+	v.Check(len(input.Cylinders) > 0, "cylinders", "Must contain at least one cylinder")
+	v.Check(len(input.Cylinders) <= 10, "cylinders", "Must contain a maximum of 10 cylinders")
+	for _, cyl := range input.Cylinders {
+		data.ValidateDiveCylinder(v, &cyl)
+		v.Check(cyl.O2 >= 5, "cylinders", "Must have an O2 percentage of at least 5 to plan with")
+
+		c := deco.Cylinder{Gas: deco.Gas{O2: cyl.O2 / 100, He: cyl.He / 100}}
+		if cyl.Size != nil && cyl.StartPressure != nil {
+			c.Size, c.Pressure = *cyl.Size, *cyl.StartPressure
+		}
+		plan.Cylinders = append(plan.Cylinders, c)
+	}
+
+	v.Check(len(input.Levels) > 0, "levels", "Must contain at least one level")
+	v.Check(len(input.Levels) <= 10, "levels", "Must contain a maximum of 10 levels")
+	for _, level := range input.Levels {
+		v.Check(level.Depth > 0 && level.Depth <= 150, "levels", "Must have depths between 0 and 150 metres")
+		v.Check(level.Minutes > 0 && level.Minutes <= 300, "levels", "Must have times between 0 and 300 minutes")
+		v.Check(level.Cylinder >= 0 && level.Cylinder < len(input.Cylinders), "levels",
+			"Must only use cylinders from the cylinders list")
+
+		plan.Levels = append(plan.Levels, deco.Level{
+			Depth:    level.Depth,
+			Minutes:  level.Minutes,
+			Cylinder: level.Cylinder,
+		})
+	}
+
+	v.Check(gfLow >= 10 && gfLow <= 100, "gf_low", "Must be between 10 and 100")
+	v.Check(gfHigh >= gfLow && gfHigh <= 100, "gf_high", "Must be between gf_low and 100")
+	v.Check(plan.DescentRate >= 1 && plan.DescentRate <= 30, "descent_rate", "Must be between 1 and 30 metres per minute")
+	v.Check(plan.AscentRate >= 1 && plan.AscentRate <= 18, "ascent_rate", "Must be between 1 and 18 metres per minute")
+	v.Check(plan.LastStop == 3 || plan.LastStop == 6, "last_stop", "Must be either 3 or 6 metres")
+	v.Check(plan.MaxDecoPPO2 >= 1 && plan.MaxDecoPPO2 <= 1.6, "max_deco_ppo2", "Must be between 1.0 and 1.6 bar")
+
+	if input.SAC != nil {
+		v.Check(*input.SAC >= 5 && *input.SAC <= 60, "sac", "Must be between 5 and 60 litres per minute")
+	}
+
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	sac, err := app.plannerSAC(r, input.SAC)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+	plan.SAC = sac.LitresPerMinute
+
+	schedule, err := plan.Run()
+	if err != nil {
+		switch {
+		case errors.Is(err, deco.ErrTooMuchDeco):
+			v.AddError("levels", "Must not need more than a day of decompression")
+			app.FailedValidationResponse(w, r, v.Errors)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	dive := newPlannedDive(plan, schedule, gfLow, gfHigh)
+	dive.SAC = *sac
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"plan": dive})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// plannerSAC returns the SAC rate to plan a dive with. This is the rate given
+// in the request if there was one. Otherwise, it is the authenticated user's
+// average SAC rate from their logged dives, or defaultPlannerSAC if they have
+// none.
+func (app *app) plannerSAC(r *http.Request, requested *float64) (*plannedSAC, error) {
+	if requested != nil {
+		return &plannedSAC{SACRate: *data.NewSACRate(*requested), Source: sacSourceRequest}, nil
+	}
+
+	avg, err := app.models.Dives.GetAverageSAC(r.Context(), app.contextGetPrincipal(r).UserID)
+	if err != nil {
+		return nil, err
+	}
+	if avg != nil {
+		return &plannedSAC{SACRate: avg.SACRate, Source: sacSourceDiver}, nil
+	}
+
+	return &plannedSAC{SACRate: *data.NewSACRate(defaultPlannerSAC), Source: sacSourceDefault}, nil
+}
+
+// newPlannedDive converts the Schedule worked out for the given Plan into the
+// form sent to clients, rounding the values to a sensible precision and
+// warning of any parts of the plan that are unsafe.
+func newPlannedDive(plan deco.Plan, s *deco.Schedule, gfLow, gfHigh int) *plannedDive {
+	dive := &plannedDive{
+		Runtime:  math.Ceil(s.Runtime),
+		Stops:    []plannedStop{},
+		Segments: []plannedSegment{},
+		Gas:      []plannedGas{},
+		CNS:      math.Round(s.CNS*10) / 10,
+		OTU:      math.Round(s.OTU),
+		GFLow:    gfLow,
+		GFHigh:   gfHigh,
+		Warnings: []string{},
+	}
+
+	for _, stop := range s.Stops {
+		dive.DecoTime += stop.Minutes
+		dive.Stops = append(dive.Stops, plannedStop{
+			Depth:    stop.Depth,
+			Minutes:  stop.Minutes,
+			Runtime:  math.Ceil(stop.Runtime),
+			Cylinder: stop.Cylinder,
+			Gas:      plan.Cylinders[stop.Cylinder].Gas.String(),
+		})
+	}
+
+	for _, seg := range s.Segments {
+		dive.Segments = append(dive.Segments, plannedSegment{
+			Kind:       seg.Kind,
+			StartDepth: seg.StartDepth,
+			EndDepth:   seg.EndDepth,
+			Minutes:    math.Round(seg.Minutes*10) / 10,
+			Runtime:    math.Round(seg.Runtime*10) / 10,
+			Cylinder:   seg.Cylinder,
+			Gas:        plan.Cylinders[seg.Cylinder].Gas.String(),
+		})
+	}
+
+	for i, litres := range s.GasUsed {
+		cyl := plan.Cylinders[i]
+		gas := plannedGas{
+			Cylinder:  i,
+			Gas:       cyl.Gas.String(),
+			Litres:    math.Round(litres),
+			CubicFeet: math.Round(litres/data.LitresPerCubicFoot*10) / 10,
+		}
+
+		if cyl.Size > 0 && cyl.Pressure > 0 {
+			used := math.Ceil(litres / cyl.Size)
+			end := cyl.Pressure - used
+			gas.PressureUsed, gas.EndPressure = &used, &end
+
+			if end < 0 {
+				dive.Warnings = append(dive.Warnings,
+					fmt.Sprintf("Cylinder %d does not hold enough gas for the dive", i))
+			}
+		}
+
+		dive.Gas = append(dive.Gas, gas)
+	}
+
+	for i, level := range plan.Levels {
+		ppo2 := plan.Cylinders[level.Cylinder].Gas.PPO2(level.Depth)
+		if ppo2 > maxBottomPPO2 {
+			dive.Warnings = append(dive.Warnings,
+				fmt.Sprintf("Level %d has a ppO2 of %.2f bar, above %.1f bar", i, ppo2, maxBottomPPO2))
+		}
+	}
+
+	if s.CNS > 100 {
+		dive.Warnings = append(dive.Warnings, "The CNS oxygen toxicity limit is exceeded")
+	}
+
+	return dive
+}
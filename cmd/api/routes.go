@@ -1,16 +1,75 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+)
 
 func (app *app) routes() http.Handler {
 	app.Router.HandlerFunc(http.MethodGet, "/v1/agency/:id", app.fetchAgencyHandler)
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/agency/:id", app.requirePermission(auth.CanManageAgencies, app.updateAgencyHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/agency/:id", app.requirePermission(auth.CanManageAgencies, app.deleteAgencyHandler))
 	app.Router.HandlerFunc(http.MethodGet, "/v1/agency", app.listAgenciesHandler)
-	app.Router.HandlerFunc(http.MethodPost, "/v1/agency", app.createAgencyHandler)
+	app.Router.HandlerFunc(http.MethodPost, "/v1/agency", app.requirePermission(auth.CanManageAgencies, app.createAgencyHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/agency/:id/course/:course_id", app.fetchAgencyCourseHandler)
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/agency/:id/course/:course_id", app.requirePermission(auth.CanManageAgencies, app.updateAgencyCourseHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/agency/:id/course/:course_id", app.requirePermission(auth.CanManageAgencies, app.deleteAgencyCourseHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/agency/:id/course", app.listAgencyCoursesHandler)
+	app.Router.HandlerFunc(http.MethodPost, "/v1/agency/:id/course", app.requirePermission(auth.CanManageAgencies, app.createAgencyCourseHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/buddy/id/:id", app.requireAuthenticatedUser(app.fetchBuddyHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/buddy/id/:id", app.requireAuthenticatedUser(app.updateBuddyHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/buddy/id/:id", app.requireAuthenticatedUser(app.deleteBuddyHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/buddy/user/:id", app.requireAuthenticatedUser(app.listBuddiesHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/buddy/request/id/:id", app.requireAuthenticatedUser(app.respondBuddyRequestHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/buddy/request/user/:id", app.requireAuthenticatedUser(app.listBuddyRequestsHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/buddy/invitation/redeem", app.requireAuthenticatedUser(app.redeemInvitationHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/buddy", app.requireAuthenticatedUser(app.createBuddyHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/certification/id/:id", app.requireAuthenticatedUser(app.fetchCertificationHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/certification/id/:id", app.requireAuthenticatedUser(app.deleteCertificationHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/certification/id/:id/sign", app.requirePermission(auth.CanSignCertifications, app.signCertificationHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/certification/user/:id", app.requireAuthenticatedUser(app.listCertificationsHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/certification", app.requireAuthenticatedUser(app.createCertificationHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive/id/:id", app.requireAuthenticatedUser(app.fetchDiveHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/dive/id/:id", app.requireAuthenticatedUser(app.updateDiveHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/dive/id/:id", app.requireAuthenticatedUser(app.deleteDiveHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive/id/:id/profile", app.requireAuthenticatedUser(app.fetchDiveProfileHandler))
+	app.Router.HandlerFunc(http.MethodPut, "/v1/dive/id/:id/profile", app.requireAuthenticatedUser(app.updateDiveProfileHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive/user/:id", app.requireAuthenticatedUser(app.listDivesHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive/user/:id/export/subsurface", app.requireAuthenticatedUser(app.exportSubsurfaceHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/dive/import/uddf", app.requireAuthenticatedUser(app.importUDDFHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/dive/import/subsurface", app.requireAuthenticatedUser(app.importSubsurfaceHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/dive", app.requireAuthenticatedUser(app.createDiveHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive-site/id/:id", app.requireAuthenticatedUser(app.fetchDiveSiteHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/dive-site/id/:id", app.requireAuthenticatedUser(app.updateDiveSiteHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/dive-site/id/:id", app.requireAuthenticatedUser(app.deleteDiveSiteHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive-site/nearby", app.requireAuthenticatedUser(app.listNearbyDiveSitesHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/dive-site", app.requireAuthenticatedUser(app.listDiveSitesHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/dive-site", app.requireAuthenticatedUser(app.createDiveSiteHandler))
+
+	app.Router.HandlerFunc(http.MethodGet, "/v1/gas/mod", app.requireAuthenticatedUser(app.gasMODHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/gas/ead", app.requireAuthenticatedUser(app.gasEADHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/gas/end", app.requireAuthenticatedUser(app.gasENDHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/gas/best-mix", app.requireAuthenticatedUser(app.gasBestMixHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/gas/blend", app.requireAuthenticatedUser(app.gasBlendHandler))
+
+	app.Router.HandlerFunc(http.MethodPost, "/v1/planner", app.requireAuthenticatedUser(app.planDiveHandler))
 
-	app.Router.HandlerFunc(http.MethodGet, "/v1/buddy/user/:id", app.listBuddiesHandler)
-	app.Router.HandlerFunc(http.MethodPost, "/v1/buddy", app.createBuddyHandler)
+	app.Router.HandlerFunc(http.MethodGet, "/v1/diver/:id", app.requireAuthenticatedUser(app.fetchDiverHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/diver/:id", app.requireAuthenticatedUser(app.updateDiverHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/diver/:id/desaturation", app.requireAuthenticatedUser(app.fetchDesaturationHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/diver", app.requireAuthenticatedUser(app.createDiverHandler))
 
-	app.Router.HandlerFunc(http.MethodPost, "/v1/diver", app.createDiverHandler)
+	app.Router.HandlerFunc(http.MethodGet, "/v1/trip/id/:id", app.requireAuthenticatedUser(app.fetchTripHandler))
+	app.Router.HandlerFunc(http.MethodPatch, "/v1/trip/id/:id", app.requireAuthenticatedUser(app.updateTripHandler))
+	app.Router.HandlerFunc(http.MethodDelete, "/v1/trip/id/:id", app.requireAuthenticatedUser(app.deleteTripHandler))
+	app.Router.HandlerFunc(http.MethodGet, "/v1/trip/user/:id", app.requireAuthenticatedUser(app.listTripsHandler))
+	app.Router.HandlerFunc(http.MethodPost, "/v1/trip", app.requireAuthenticatedUser(app.createTripHandler))
 
-	return app.Metrics(app.RecoverPanic(app.Router))
+	return app.Metrics(app.RecoverPanic(app.authenticate(app.Router)))
 }
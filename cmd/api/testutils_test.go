@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/auth"
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+	"github.com/m5lapp/go-service-toolkit/config"
+	"github.com/m5lapp/go-service-toolkit/webapp"
+	"golang.org/x/exp/slog"
+)
+
+// newTestApp returns an app that looks users up in the given Fake and
+// authenticates tokens by introspection against it. If no queries are given it
+// has no database, so tests must only exercise paths that return before
+// reaching one. Otherwise, its database answers the given queries.
+func newTestApp(t *testing.T, users *usersvc.Fake, queries ...testQuery) *app {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	var db *sql.DB
+	if len(queries) > 0 {
+		db = sql.OpenDB(testConnector{t: t, queries: queries})
+		t.Cleanup(func() { db.Close() })
+	}
+
+	return &app{
+		WebApp: webapp.New(config.Server{}, logger),
+		auth:   auth.NewIntrospectionAuthenticator(users),
+		models: data.NewModels(db, data.Timeouts{Read: time.Second, Write: time.Second}),
+		users:  users,
+	}
+}
+
+// testQuery is a canned response from a test database to any statement that
+// contains match. Queries return rows, which all have the same number of
+// columns as the statement selects, and other statements report rowsAffected.
+type testQuery struct {
+	match        string
+	rows         [][]driver.Value
+	rowsAffected int64
+}
+
+// testConnector is a database/sql connector for a database that answers each
+// statement with the first of its queries that matches it. Transactions are
+// accepted but do nothing. Any statement that no query matches fails the test.
+type testConnector struct {
+	t       *testing.T
+	queries []testQuery
+}
+
+func (c testConnector) Connect(context.Context) (driver.Conn, error) { return testConn(c), nil }
+func (c testConnector) Driver() driver.Driver                        { return nil }
+
+type testConn testConnector
+
+func (c testConn) find(query string) (testQuery, error) {
+	for _, q := range c.queries {
+		if strings.Contains(query, q.match) {
+			return q, nil
+		}
+	}
+
+	c.t.Errorf("unexpected statement: %s", strings.Join(strings.Fields(query), " "))
+	return testQuery{}, errors.New("unexpected statement")
+}
+
+func (c testConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	q, err := c.find(query)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := &testRows{rows: q.rows}
+	if len(q.rows) > 0 {
+		rows.columns = make([]string, len(q.rows[0]))
+	}
+
+	return rows, nil
+}
+
+func (c testConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	q, err := c.find(query)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(q.rowsAffected), nil
+}
+
+func (c testConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c testConn) Close() error                        { return nil }
+func (c testConn) Begin() (driver.Tx, error)           { return c, nil }
+func (c testConn) Commit() error                       { return nil }
+func (c testConn) Rollback() error                     { return nil }
+
+type testRows struct {
+	columns []string
+	rows    [][]driver.Value
+}
+
+func (r *testRows) Columns() []string { return r.columns }
+func (r *testRows) Close() error      { return nil }
+
+func (r *testRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+
+	return nil
+}
+
+// testResponse is a JSend response with its data decoded into a map.
+type testResponse struct {
+	Status string         `json:"status"`
+	Data   map[string]any `json:"data"`
+}
+
+// serve sends a request with the given JSON body to the handler and returns
+// the status code and the decoded response. If userID is not empty, the
+// request is made as that user without going through the authenticate
+// middleware.
+func serve(t *testing.T, app *app, h http.Handler, method, userID, token string, body any) (int, testResponse) {
+	t.Helper()
+
+	js, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(method, "/", bytes.NewReader(js))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	if userID != "" {
+		r = app.contextSetPrincipal(r, &auth.Principal{UserID: userID, Roles: []string{auth.RoleDiver}})
+	}
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, r)
+
+	var res testResponse
+	err = json.NewDecoder(rr.Body).Decode(&res)
+	if err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+
+	return rr.Code, res
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+func (app *app) createTripHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name           string         `json:"name"`
+		StartDate      jsonz.DateOnly `json:"start_date"`
+		EndDate        jsonz.DateOnly `json:"end_date"`
+		Country        *string        `json:"country"`
+		TimeZone       *string        `json:"time_zone"`
+		Itinerary      *string        `json:"itinerary"`
+		ParticipantIDs []int64        `json:"participant_ids"`
+		SiteIDs        []int64        `json:"site_ids"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	trip := &data.Trip{
+		UserID:         app.contextGetPrincipal(r).UserID,
+		Name:           input.Name,
+		StartDate:      input.StartDate,
+		EndDate:        input.EndDate,
+		Country:        input.Country,
+		TimeZone:       input.TimeZone,
+		Itinerary:      input.Itinerary,
+		ParticipantIDs: input.ParticipantIDs,
+		SiteIDs:        input.SiteIDs,
+	}
+
+	if trip.ParticipantIDs == nil {
+		trip.ParticipantIDs = []int64{}
+	}
+	if trip.SiteIDs == nil {
+		trip.SiteIDs = []int64{}
+	}
+
+	// Trips can only be created by registered divers.
+	diver, err := app.models.Divers.GetByID(r.Context(), trip.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.diverRequiredResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Default the destination to where the diver usually dives if it was not
+	// provided.
+	if trip.Country == nil {
+		trip.Country = diver.DefaultDivingCountry
+	}
+	if trip.TimeZone == nil {
+		trip.TimeZone = diver.DefaultDivingTZ
+	}
+
+	v := validator.New()
+
+	data.ValidateTrip(v, trip)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Trips.Insert(r.Context(), trip)
+	if err != nil {
+		if !app.constraintViolationResponse(w, r, err) {
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.Logger.Info("New trip successfully created", "user", trip.UserID,
+		"trip", trip.ID)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/trip/id/%d", trip.ID))
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusCreated, headers, jsonz.Envelope{"trip": trip})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readTripParam reads the trip ID URL parameter from the request and fetches
+// the matching Trip from the database. If it does not exist, does not belong
+// to the authenticated user or the parameter is invalid, an appropriate
+// response will be sent and nil will be returned.
+func (app *app) readTripParam(w http.ResponseWriter, r *http.Request) *data.Trip {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	trip, err := app.models.Trips.GetOneByID(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	// Don't reveal that other divers' trips exist.
+	if trip.UserID != app.contextGetPrincipal(r).UserID {
+		app.NotFoundResponse(w, r)
+		return nil
+	}
+
+	return trip
+}
+
+func (app *app) fetchTripHandler(w http.ResponseWriter, r *http.Request) {
+	trip := app.readTripParam(w, r)
+	if trip == nil {
+		return
+	}
+
+	err := jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"trip": trip})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) listTripsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	userID := app.readUserIDParam(r, v)
+
+	when := app.ReadString(qs, "when", data.TripsAll)
+	v.Check(validator.PermittedValue(when, data.TripsAll, data.TripsPast, data.TripsUpcoming),
+		"when", "Must be one of all, past or upcoming")
+
+	// Past trips are most useful with the most recent first, all others with
+	// the soonest first.
+	defaultSort := "start_date"
+	if when == data.TripsPast {
+		defaultSort = "-start_date"
+	}
+
+	filters := app.readFilters(qs, v, defaultSort, "start_date", "end_date", "name")
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.requireActingUser(w, r, userID) {
+		return
+	}
+
+	trips, metadata, err := app.models.Trips.GetAllForDiver(r.Context(), userID, when, filters)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	data := jsonz.Envelope{"trips": trips, "metadata": metadata}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) updateTripHandler(w http.ResponseWriter, r *http.Request) {
+	trip := app.readTripParam(w, r)
+	if trip == nil {
+		return
+	}
+
+	// Make sure that nobody else has changed the trip since the version that
+	// the client's changes are based on.
+	if !app.requireExpectedVersion(w, r, trip.Version) {
+		return
+	}
+
+	// Use pointers so that we can tell which fields were provided by the client
+	// and only update those.
+	var input struct {
+		Name           *string         `json:"name"`
+		StartDate      *jsonz.DateOnly `json:"start_date"`
+		EndDate        *jsonz.DateOnly `json:"end_date"`
+		Country        *string         `json:"country"`
+		TimeZone       *string         `json:"time_zone"`
+		Itinerary      *string         `json:"itinerary"`
+		ParticipantIDs *[]int64        `json:"participant_ids"`
+		SiteIDs        *[]int64        `json:"site_ids"`
+	}
+
+	err := jsonz.ReadJSON(w, r, &input)
+	if err != nil {
+		app.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		trip.Name = *input.Name
+	}
+	if input.StartDate != nil {
+		trip.StartDate = *input.StartDate
+	}
+	if input.EndDate != nil {
+		trip.EndDate = *input.EndDate
+	}
+	if input.Country != nil {
+		trip.Country = input.Country
+	}
+	if input.TimeZone != nil {
+		trip.TimeZone = input.TimeZone
+	}
+	if input.Itinerary != nil {
+		trip.Itinerary = input.Itinerary
+	}
+	if input.ParticipantIDs != nil {
+		trip.ParticipantIDs = *input.ParticipantIDs
+	}
+	if input.SiteIDs != nil {
+		trip.SiteIDs = *input.SiteIDs
+	}
+
+	if trip.ParticipantIDs == nil {
+		trip.ParticipantIDs = []int64{}
+	}
+	if trip.SiteIDs == nil {
+		trip.SiteIDs = []int64{}
+	}
+
+	v := validator.New()
+
+	data.ValidateTrip(v, trip)
+	if !v.Valid() {
+		app.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Trips.Update(r.Context(), trip)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.EditConflictResponse(w, r)
+		default:
+			if !app.constraintViolationResponse(w, r, err) {
+				app.ServerErrorResponse(w, r, err)
+			}
+		}
+		return
+	}
+
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, jsonz.Envelope{"trip": trip})
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (app *app) deleteTripHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.ReadIDParam(r)
+	if err != nil {
+		app.NotFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Trips.Delete(r.Context(), app.contextGetPrincipal(r).UserID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.NotFoundResponse(w, r)
+		default:
+			app.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	data := jsonz.Envelope{"message": "Trip successfully deleted"}
+	err = jsonz.WriteJSendSuccess(w, http.StatusOK, nil, data)
+	if err != nil {
+		app.ServerErrorResponse(w, r, err)
+	}
+}
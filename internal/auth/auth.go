@@ -0,0 +1,99 @@
+// Package auth authenticates the bearer tokens that clients send with their
+// requests, working out which user is making each request. Tokens can either
+// be verified locally as signed JWTs or introspected by the User service.
+package auth
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	ModeJWT        = "jwt"
+	ModeIntrospect = "introspect"
+)
+
+var ErrInvalidToken = errors.New("invalid authentication token")
+
+// Principal is the authenticated user that a request is being made by, along
+// with the roles that they hold.
+type Principal struct {
+	UserID string
+	Roles  []string
+}
+
+// newPrincipal returns a Principal for the given user with the given roles.
+// Roles that are not recognised are dropped and every authenticated user is a
+// diver, whether or not their token says so.
+func newPrincipal(userID string, roles []string) *Principal {
+	p := &Principal{UserID: userID, Roles: []string{RoleDiver}}
+
+	for _, role := range roles {
+		if role != RoleDiver && slices.Contains(knownRoles, role) {
+			p.Roles = append(p.Roles, role)
+		}
+	}
+
+	return p
+}
+
+// AnonymousPrincipal represents a request that did not include an
+// authentication token.
+var AnonymousPrincipal = &Principal{}
+
+// IsAnonymous reports whether the Principal is the AnonymousPrincipal.
+func (p *Principal) IsAnonymous() bool {
+	return p == AnonymousPrincipal
+}
+
+// Authenticator checks a bearer token and returns the Principal that it was
+// issued to. If the token is not valid, ErrInvalidToken is returned.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// Config stores the settings that control how bearer tokens are authenticated.
+type Config struct {
+	Mode        string
+	JWKSURL     string
+	HMACSecret  string
+	Issuer      string
+	Audience    string
+	JWKSRefresh time.Duration
+}
+
+// Flags parses the flags for authenticating bearer tokens.
+func (c *Config) Flags() {
+	flag.StringVar(&c.Mode, "auth-mode", ModeJWT,
+		"How bearer tokens are authenticated (jwt|introspect)")
+	flag.StringVar(&c.JWKSURL, "auth-jwks-url", "",
+		"URL of the JSON Web Key Set used to verify JWTs")
+	flag.StringVar(&c.HMACSecret, "auth-hmac-secret", "",
+		"Shared secret used to verify HS256 signed JWTs instead of a JWKS")
+	flag.StringVar(&c.Issuer, "auth-issuer", "",
+		"Required iss claim of JWTs, empty to not check it")
+	flag.StringVar(&c.Audience, "auth-audience", "",
+		"Required aud claim of JWTs, empty to not check it")
+	flag.DurationVar(&c.JWKSRefresh, "auth-jwks-refresh", 15*time.Minute,
+		"How often the JWKS is fetched again (time.Duration)")
+}
+
+// New returns the Authenticator for the mode given in cfg. The User service
+// client is only used in introspect mode.
+func New(cfg Config, users usersvc.Client, logger *slog.Logger) (Authenticator, error) {
+	switch cfg.Mode {
+	case ModeJWT:
+		return NewJWTAuthenticator(cfg, logger)
+	case ModeIntrospect:
+		return NewIntrospectionAuthenticator(users), nil
+	default:
+		return nil, fmt.Errorf("unknown authentication mode %q", cfg.Mode)
+	}
+}
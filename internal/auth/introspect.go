@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/usersvc"
+)
+
+var _ Authenticator = (*IntrospectionAuthenticator)(nil)
+
+// IntrospectionAuthenticator authenticates bearer tokens by asking the User
+// service who they belong to. This costs a request per authenticated call, but
+// means that revoked tokens stop working straight away.
+type IntrospectionAuthenticator struct {
+	users usersvc.Client
+}
+
+// NewIntrospectionAuthenticator returns a new IntrospectionAuthenticator that
+// uses the given User service client.
+func NewIntrospectionAuthenticator(users usersvc.Client) *IntrospectionAuthenticator {
+	return &IntrospectionAuthenticator{users: users}
+}
+
+// Authenticate looks up the user that the given token was issued to, along
+// with their roles.
+func (a *IntrospectionAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	user, err := a.users.GetByToken(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, usersvc.ErrInvalidToken), errors.Is(err, usersvc.ErrNotFound):
+			return nil, ErrInvalidToken
+		default:
+			return nil, err
+		}
+	}
+
+	return newPrincipal(user.UserID, user.Roles), nil
+}
@@ -0,0 +1,234 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// minJWKSRefresh is the shortest time allowed between fetches of the JWKS, so
+// that tokens with unknown key IDs cannot be used to flood the issuer with
+// requests.
+const minJWKSRefresh = time.Minute
+
+// jwk is a single JSON Web Key. Only the members needed for RSA and P-256
+// elliptic curve public keys are decoded.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet is a cached JSON Web Key Set. The keys are fetched again once they
+// are older than the refresh interval, or when a token refers to a key ID that
+// is not in the set, as happens after the issuer rotates its keys. Fetches are
+// made without holding the lock, and only one is made at a time.
+type keySet struct {
+	url     string
+	refresh time.Duration
+	http    *http.Client
+	logger  *slog.Logger
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+	attempted time.Time
+	// fetching is closed when the fetch in progress finishes, and is nil if
+	// there is none.
+	fetching chan struct{}
+}
+
+func newKeySet(url string, refresh time.Duration, logger *slog.Logger) *keySet {
+	return &keySet{
+		url:     url,
+		refresh: refresh,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		logger:  logger,
+	}
+}
+
+// get returns the public key with the given key ID, fetching the key set if it
+// is stale or does not contain the key. The key set is fetched at most once
+// every minJWKSRefresh, whether or not the fetch succeeds, and callers that
+// need it while it is being fetched wait for that fetch to finish.
+func (ks *keySet) get(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		ks.mu.Lock()
+
+		key, ok := ks.keys[kid]
+		stale := time.Since(ks.fetched) >= ks.refresh
+		throttled := time.Since(ks.attempted) < minJWKSRefresh
+		wait := ks.fetching
+
+		// Keys that are only stale can still be used while they are fetched.
+		switch {
+		case ok && (!stale || throttled || wait != nil):
+			ks.mu.Unlock()
+			return key, nil
+		case wait != nil:
+			ks.mu.Unlock()
+
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		case throttled:
+			ks.mu.Unlock()
+			return nil, ErrInvalidToken
+		}
+
+		done := make(chan struct{})
+		ks.fetching = done
+		ks.attempted = time.Now()
+		ks.mu.Unlock()
+
+		// The fetch is shared with any callers that wait for it, so it must
+		// not be cancelled if this caller gives up.
+		keys, err := ks.fetch(context.WithoutCancel(ctx))
+
+		ks.mu.Lock()
+		if err == nil {
+			ks.keys = keys
+			ks.fetched = time.Now()
+		}
+		ks.fetching = nil
+		close(done)
+		ks.mu.Unlock()
+
+		if err != nil {
+			// Keep using the keys we already have if the issuer is unavailable.
+			ks.logger.Error("Fetching JWKS failed", "url", ks.url, "error", err.Error())
+			if ok {
+				return key, nil
+			}
+			return nil, err
+		}
+
+		key, ok = keys[kid]
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		return key, nil
+	}
+}
+
+// fetch downloads and parses the key set. Keys of an unsupported type, or that
+// are not for signing, are skipped.
+func (ks *keySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ks.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d fetching JWKS", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1_048_576)).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("decoding JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			ks.logger.Warn("Skipping JWKS key", "kid", k.Kid, "error", err.Error())
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+// publicKey converts the JSON Web Key into an RSA or ECDSA public key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !pub.Curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on the curve")
+		}
+
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big-endian unsigned integer.
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// testJWKS is a JWKS endpoint serving a single P-256 key with the ID "k1". It
+// counts the requests it receives, and fails them while failing is set.
+type testJWKS struct {
+	*httptest.Server
+	requests atomic.Int32
+	failing  atomic.Bool
+	// release, if not nil, blocks each request until it is closed.
+	release chan struct{}
+}
+
+func newTestJWKS(t *testing.T, release chan struct{}) *testJWKS {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc := base64.RawURLEncoding
+	body := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","use":"sig","crv":"P-256","x":%q,"y":%q}]}`,
+		enc.EncodeToString(priv.X.FillBytes(make([]byte, 32))),
+		enc.EncodeToString(priv.Y.FillBytes(make([]byte, 32))))
+
+	s := &testJWKS{release: release}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.release != nil {
+			<-s.release
+		}
+		if s.failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newTestKeySet(url string) *keySet {
+	return newKeySet(url, time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func TestKeySetConcurrentFetch(t *testing.T) {
+	release := make(chan struct{})
+	jwks := newTestJWKS(t, release)
+	ks := newTestKeySet(jwks.URL)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := ks.get(context.Background(), "k1")
+			errs <- err
+		}()
+	}
+
+	// A caller whose context ends stops waiting for the fetch.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for {
+		ks.mu.Lock()
+		fetching := ks.fetching != nil
+		ks.mu.Unlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := ks.get(ctx, "k1"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got error %v while waiting, want %v", err, context.DeadlineExceeded)
+	}
+
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if got := jwks.requests.Load(); got != 1 {
+		t.Errorf("got %d fetches, want 1", got)
+	}
+}
+
+func TestKeySetThrottlesFailedFetches(t *testing.T) {
+	jwks := newTestJWKS(t, nil)
+	jwks.failing.Store(true)
+	ks := newTestKeySet(jwks.URL)
+	ctx := context.Background()
+
+	if _, err := ks.get(ctx, "k1"); err == nil || errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got error %v, want a fetch error", err)
+	}
+
+	// Until minJWKSRefresh has passed, unknown keys are rejected without
+	// fetching the key set again.
+	for i := 0; i < 5; i++ {
+		if _, err := ks.get(ctx, "k1"); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("got error %v, want %v", err, ErrInvalidToken)
+		}
+	}
+	if got := jwks.requests.Load(); got != 1 {
+		t.Errorf("got %d fetches, want 1", got)
+	}
+
+	jwks.failing.Store(false)
+	ks.attempted = time.Now().Add(-minJWKSRefresh)
+	if _, err := ks.get(ctx, "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ks.get(ctx, "k2"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("got error %v for an unknown key, want %v", err, ErrInvalidToken)
+	}
+	if got := jwks.requests.Load(); got != 2 {
+		t.Errorf("got %d fetches, want 2", got)
+	}
+}
+
+func TestKeySetKeepsStaleKeys(t *testing.T) {
+	jwks := newTestJWKS(t, nil)
+	ks := newTestKeySet(jwks.URL)
+	ctx := context.Background()
+
+	if _, err := ks.get(ctx, "k1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// When the keys are stale and the issuer is unavailable, the keys that are
+	// already known are still used.
+	jwks.failing.Store(true)
+	ks.fetched = time.Now().Add(-2 * time.Hour)
+	ks.attempted = ks.fetched
+
+	for i := 0; i < 3; i++ {
+		if _, err := ks.get(ctx, "k1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := jwks.requests.Load(); got != 2 {
+		t.Errorf("got %d fetches, want 2", got)
+	}
+}
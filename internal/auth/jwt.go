@@ -0,0 +1,220 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// leeway is how far the clocks of this service and the token issuer are
+// allowed to drift apart when checking the time based claims of a JWT.
+const leeway = 30 * time.Second
+
+var _ Authenticator = (*JWTAuthenticator)(nil)
+
+// jwtHeader is the decoded JOSE header of a JWT.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// jwtClaims holds the registered claims of a JWT that are checked, along with
+// the private roles claim. The aud claim may be either a single string or an
+// array of strings.
+type jwtClaims struct {
+	Sub   string          `json:"sub"`
+	Iss   string          `json:"iss"`
+	Aud   json.RawMessage `json:"aud"`
+	Exp   *int64          `json:"exp"`
+	Nbf   *int64          `json:"nbf"`
+	Roles []string        `json:"roles"`
+}
+
+// JWTAuthenticator authenticates bearer tokens that are JWTs signed by a
+// trusted issuer. Tokens signed with HS256 are verified with a shared secret,
+// while RS256 and ES256 tokens are verified against a JSON Web Key Set. The
+// subject claim of the token is taken as the user ID and the roles claim as the
+// user's roles.
+type JWTAuthenticator struct {
+	secret   []byte
+	keys     *keySet
+	issuer   string
+	audience string
+}
+
+// NewJWTAuthenticator returns a new JWTAuthenticator. Either an HMAC secret or
+// a JWKS URL must be configured.
+func NewJWTAuthenticator(cfg Config, logger *slog.Logger) (*JWTAuthenticator, error) {
+	a := &JWTAuthenticator{issuer: cfg.Issuer, audience: cfg.Audience}
+
+	switch {
+	case cfg.HMACSecret != "":
+		a.secret = []byte(cfg.HMACSecret)
+	case cfg.JWKSURL != "":
+		a.keys = newKeySet(cfg.JWKSURL, cfg.JWKSRefresh, logger)
+	default:
+		return nil, errors.New("either a JWKS URL or an HMAC secret is required to verify JWTs")
+	}
+
+	return a, nil
+}
+
+// Authenticate verifies the signature and claims of the given JWT.
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header jwtHeader
+	err := decodeSegment(parts[0], &header)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	err = a.verify(ctx, header, []byte(parts[0]+"."+parts[1]), sig)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	err = decodeSegment(parts[1], &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !a.validClaims(claims, time.Now()) {
+		return nil, ErrInvalidToken
+	}
+
+	return newPrincipal(claims.Sub, claims.Roles), nil
+}
+
+// verify checks the signature of the signed part of a JWT. The algorithm is
+// only accepted if it matches the kind of key that is configured, so that a
+// public key can never be used as an HMAC secret.
+func (a *JWTAuthenticator) verify(ctx context.Context, header jwtHeader, signed, sig []byte) error {
+	if a.secret != nil {
+		if header.Alg != "HS256" {
+			return ErrInvalidToken
+		}
+
+		mac := hmac.New(sha256.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+
+	key, err := a.keys.get(ctx, header.Kid)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(signed)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return ErrInvalidToken
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidToken
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(sig) != 64 {
+			return ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidToken
+		}
+	default:
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+// validClaims checks that the claims identify a user, are within their
+// validity period at the given time and, if configured, were issued by the
+// expected issuer for the expected audience.
+func (a *JWTAuthenticator) validClaims(claims jwtClaims, now time.Time) bool {
+	if claims.Sub == "" || claims.Exp == nil {
+		return false
+	}
+
+	if now.After(time.Unix(*claims.Exp, 0).Add(leeway)) {
+		return false
+	}
+
+	if claims.Nbf != nil && now.Add(leeway).Before(time.Unix(*claims.Nbf, 0)) {
+		return false
+	}
+
+	if a.issuer != "" && claims.Iss != a.issuer {
+		return false
+	}
+
+	if a.audience != "" && !audienceContains(claims.Aud, a.audience) {
+		return false
+	}
+
+	return true
+}
+
+// audienceContains reports whether the raw aud claim, which may be a string or
+// an array of strings, contains the given audience.
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == audience
+	}
+
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, aud := range many {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a JWT into dst.
+func decodeSegment(seg string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	err = dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("decoding JWT segment: %w", err)
+	}
+
+	return nil
+}
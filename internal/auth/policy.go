@@ -0,0 +1,52 @@
+package auth
+
+import "slices"
+
+// The roles that a Principal can hold.
+const (
+	RoleDiver           = "diver"
+	RoleInstructor      = "instructor"
+	RoleDiveCentreStaff = "dive-centre-staff"
+	RoleAdmin           = "admin"
+)
+
+var knownRoles = []string{RoleDiver, RoleInstructor, RoleDiveCentreStaff, RoleAdmin}
+
+// HasRole reports whether the Principal holds any of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if slices.Contains(p.Roles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// A Policy decides whether a Principal is allowed to perform an action.
+type Policy func(p *Principal) bool
+
+// CanManageAgencies allows admins to create, edit and delete agencies and the
+// courses that they offer.
+func CanManageAgencies(p *Principal) bool {
+	return p.HasRole(RoleAdmin)
+}
+
+// CanManageDiveSites allows admins and dive centre staff to edit and delete any
+// site in the dive site catalogue, not just those that they added.
+func CanManageDiveSites(p *Principal) bool {
+	return p.HasRole(RoleAdmin, RoleDiveCentreStaff)
+}
+
+// CanSignCertifications allows instructors to sign divers' certifications to
+// confirm that they were issued.
+func CanSignCertifications(p *Principal) bool {
+	return p.HasRole(RoleInstructor)
+}
+
+// CanActAsDiver reports whether the Principal may read and change the profile,
+// buddies and certifications of the diver with the given user ID. Divers may
+// only touch their own records.
+func CanActAsDiver(p *Principal, userID string) bool {
+	return !p.IsAnonymous() && p.UserID == userID
+}
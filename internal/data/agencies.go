@@ -4,15 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"time"
+	"fmt"
 
-	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
 
 // Agency represents a diving certification agency.
 type Agency struct {
 	ID         int64   `json:"id"`
+	Version    int     `json:"version"`
 	CommonName string  `json:"common_name"`
 	FullName   string  `json:"full_name"`
 	Acronym    *string `json:"acronym,omitempty"`
@@ -20,7 +20,8 @@ type Agency struct {
 }
 
 type AgencyModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
 // ValidateAgency validates an Agency struct and stores any errors in the
@@ -41,10 +42,10 @@ func ValidateAgency(v *validator.Validator, agency *Agency) {
 	}
 }
 
-// Insert adds the given dive certification Agency into the database. If the email address (case
-// insensitive) already exists in the database, then an ErrDuplicateEmail
-// response will be returned.
-func (m AgencyModel) Insert(agency *Agency) error {
+// Insert adds the given dive certification Agency into the database. If the
+// common name or full name already exists in the database, then an
+// ErrUniqueConstraintViolation will be returned.
+func (m AgencyModel) Insert(ctx context.Context, agency *Agency) error {
 	// The INSERT query returns the automatically generated values so that they
 	// can be added to the User struct.
 	query := `
@@ -52,7 +53,7 @@ func (m AgencyModel) Insert(agency *Agency) error {
 			common_name, full_name, acronym, url
 		)
 		values ($1, $2, $3, $4)
-	 returning id
+	 returning id, version
 	`
 
 	args := []any{
@@ -62,43 +63,37 @@ func (m AgencyModel) Insert(agency *Agency) error {
 		agency.URL,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, args...)
-	err := row.Scan(&agency.ID)
+	err := row.Scan(&agency.ID, &agency.Version)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "agencies_common_name_key"`:
-			return sqldb.NewUniqueConstraintErr("agencies", "common_name")
-		case err.Error() == `pq: duplicate key value violates unique constraint "agencies_full_name_key"`:
-			return sqldb.NewUniqueConstraintErr("agencies", "full_name")
-		default:
-			return err
-		}
+		return translateError(err)
 	}
 
 	return nil
 }
 
-func (m AgencyModel) GetOneByID(id int64) (*Agency, error) {
+func (m AgencyModel) GetOneByID(ctx context.Context, id int64) (*Agency, error) {
 	if id < 1 {
 		return nil, ErrRecordNotFound
 	}
 	query := `
 		select
-		      id, common_name, full_name, acronym, url
+		      id, version, common_name, full_name, acronym, url
 		 from agencies
 		where id = $1
 	`
 
 	var agency Agency
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
 		&agency.ID,
+		&agency.Version,
 		&agency.CommonName,
 		&agency.FullName,
 		&agency.Acronym,
@@ -117,37 +112,47 @@ func (m AgencyModel) GetOneByID(id int64) (*Agency, error) {
 	return &agency, nil
 }
 
-// GetAll queries the database for all the dive certification agencies.
-func (m AgencyModel) GetAll() ([]*Agency, error) {
-	query := `
+// GetAll queries the database for a page of the dive certification agencies,
+// sorted and paginated according to the given Filters. If acronym is not
+// empty, only agencies with that acronym (case insensitive) are returned.
+func (m AgencyModel) GetAll(ctx context.Context, acronym string, filters Filters) ([]*Agency, Metadata, error) {
+	query := fmt.Sprintf(`
 		select
-		       id, common_name, full_name, acronym, url
+		       count(*) over(), id, version, common_name, full_name, acronym,
+		       url
 		  from agencies
-	  order by common_name desc
-	`
+		 where (lower(acronym) = lower($1) or $1 = '')
+	  order by %s %s, id asc
+		 limit $2 offset $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{acronym, filters.limit(), filters.offset()}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	agencies := []*Agency{}
 	for rows.Next() {
 		var agency Agency
 
 		err := rows.Scan(
+			&totalRecords,
 			&agency.ID,
+			&agency.Version,
 			&agency.CommonName,
 			&agency.FullName,
 			&agency.Acronym,
 			&agency.URL,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		agencies = append(agencies, &agency)
@@ -155,8 +160,83 @@ func (m AgencyModel) GetAll() ([]*Agency, error) {
 
 	err = rows.Err()
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	return agencies, nil
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return agencies, metadata, nil
+}
+
+// Update updates the details of the given Agency in the database. The update
+// will only succeed if the version in the database still matches that of the
+// given agency, otherwise ErrEditConflict is returned. On success, the agency's
+// Version field is updated to the new value.
+func (m AgencyModel) Update(ctx context.Context, agency *Agency) error {
+	query := `
+		update agencies
+		   set common_name = $1, full_name = $2, acronym = $3, url = $4,
+		       version = version + 1
+		 where id = $5
+		   and version = $6
+	 returning version
+	`
+
+	args := []any{
+		agency.CommonName,
+		agency.FullName,
+		agency.Acronym,
+		agency.URL,
+		agency.ID,
+		agency.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&agency.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the Agency with the given ID from the database along with all
+// of its courses. If no matching record exists, ErrRecordNotFound is returned.
+// If any of the agency's courses are still referenced by a diver's
+// certification, ErrRecordInUse is returned.
+func (m AgencyModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from agencies
+		 where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return translateDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
 }
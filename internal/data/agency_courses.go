@@ -0,0 +1,254 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// AgencyCourse represents a course offered by a diving certification Agency.
+type AgencyCourse struct {
+	ID                int64   `json:"id"`
+	AgencyID          int64   `json:"agency_id"`
+	Name              string  `json:"name"`
+	URL               *string `json:"url,omitempty"`
+	IsSpecialtyCourse bool    `json:"is_specialty_course"`
+	IsTechCourse      bool    `json:"is_tech_course"`
+	IsProCourse       bool    `json:"is_pro_course"`
+}
+
+// AgencyCourseFilters holds the optional filters that can be applied when
+// listing an Agency's courses. A nil field means that no filtering will be done
+// on that flag.
+type AgencyCourseFilters struct {
+	IsSpecialtyCourse *bool
+	IsTechCourse      *bool
+	IsProCourse       *bool
+}
+
+type AgencyCourseModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// ValidateAgencyCourse validates an AgencyCourse struct and stores any errors in
+// the provided validator.Validator struct.
+func ValidateAgencyCourse(v *validator.Validator, course *AgencyCourse) {
+	v.Check(course.Name != "", "name", "Must be provided")
+	validator.ValidateStrLenRune(v, course.Name, "name", 2, 256)
+
+	if course.URL != nil {
+		validator.ValidateURLHTTP(v, *course.URL, "url")
+	}
+}
+
+// Insert adds the given AgencyCourse into the database. If the Agency already
+// has a course with the same name, then an ErrUniqueConstraintViolation will be
+// returned.
+func (m AgencyCourseModel) Insert(ctx context.Context, course *AgencyCourse) error {
+	query := `
+		insert into agency_courses (
+			agency_id, name, url, is_specialty_course, is_tech_course,
+			is_pro_course
+		)
+		values ($1, $2, $3, $4, $5, $6)
+	 returning id
+	`
+
+	args := []any{
+		course.AgencyID,
+		course.Name,
+		course.URL,
+		course.IsSpecialtyCourse,
+		course.IsTechCourse,
+		course.IsProCourse,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&course.ID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// GetOneByID queries the database for the course with the given ID that
+// belongs to the Agency with the given agencyID. If no matching record exists,
+// ErrRecordNotFound is returned.
+func (m AgencyCourseModel) GetOneByID(ctx context.Context, agencyID, id int64) (*AgencyCourse, error) {
+	if agencyID < 1 || id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select
+		      id, agency_id, name, url, is_specialty_course, is_tech_course,
+		      is_pro_course
+		 from agency_courses
+		where id = $1
+		  and agency_id = $2
+	`
+
+	var course AgencyCourse
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, agencyID).Scan(
+		&course.ID,
+		&course.AgencyID,
+		&course.Name,
+		&course.URL,
+		&course.IsSpecialtyCourse,
+		&course.IsTechCourse,
+		&course.IsProCourse,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &course, nil
+}
+
+// GetAllForAgency queries the database for all the courses offered by the
+// Agency with the given agencyID, optionally filtered by the course type flags.
+func (m AgencyCourseModel) GetAllForAgency(ctx context.Context, agencyID int64, filters AgencyCourseFilters) ([]*AgencyCourse, error) {
+	query := `
+		select
+		       id, agency_id, name, url, is_specialty_course, is_tech_course,
+		       is_pro_course
+		  from agency_courses
+		 where agency_id = $1
+		   and ($2::boolean is null or is_specialty_course = $2)
+		   and ($3::boolean is null or is_tech_course = $3)
+		   and ($4::boolean is null or is_pro_course = $4)
+	  order by name asc
+	`
+
+	args := []any{
+		agencyID,
+		filters.IsSpecialtyCourse,
+		filters.IsTechCourse,
+		filters.IsProCourse,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []*AgencyCourse{}
+	for rows.Next() {
+		var course AgencyCourse
+
+		err := rows.Scan(
+			&course.ID,
+			&course.AgencyID,
+			&course.Name,
+			&course.URL,
+			&course.IsSpecialtyCourse,
+			&course.IsTechCourse,
+			&course.IsProCourse,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		courses = append(courses, &course)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return courses, nil
+}
+
+// Update updates the details of the given AgencyCourse in the database. If the
+// course no longer exists, ErrRecordNotFound is returned.
+func (m AgencyCourseModel) Update(ctx context.Context, course *AgencyCourse) error {
+	query := `
+		update agency_courses
+		   set name = $1, url = $2, is_specialty_course = $3,
+		       is_tech_course = $4, is_pro_course = $5
+		 where id = $6
+		   and agency_id = $7
+	 returning id
+	`
+
+	args := []any{
+		course.Name,
+		course.URL,
+		course.IsSpecialtyCourse,
+		course.IsTechCourse,
+		course.IsProCourse,
+		course.ID,
+		course.AgencyID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&course.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the course with the given ID belonging to the Agency with the
+// given agencyID from the database. If no matching record exists,
+// ErrRecordNotFound is returned. If any diver holds a certification for the
+// course, ErrRecordInUse is returned.
+func (m AgencyCourseModel) Delete(ctx context.Context, agencyID, id int64) error {
+	if agencyID < 1 || id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from agency_courses
+		 where id = $1
+		   and agency_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, agencyID)
+	if err != nil {
+		return translateDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -3,15 +3,38 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
+	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
 
+// The possible statuses of a Buddy that is linked to another diver's account.
+// Unlinked buddies do not have a status.
+const (
+	BuddyStatusPending  = "pending"
+	BuddyStatusAccepted = "accepted"
+	BuddyStatusDeclined = "declined"
+	BuddyStatusBlocked  = "blocked"
+)
+
+// buddyStatusTransitions maps each buddy status to the statuses that the
+// recipient of a buddy request may move it to.
+var buddyStatusTransitions = map[string][]string{
+	BuddyStatusPending:  {BuddyStatusAccepted, BuddyStatusDeclined, BuddyStatusBlocked},
+	BuddyStatusDeclined: {BuddyStatusAccepted, BuddyStatusBlocked},
+	BuddyStatusAccepted: {BuddyStatusBlocked},
+	BuddyStatusBlocked:  {BuddyStatusDeclined},
+}
+
 // Buddy represents a diver's buddy.
 type Buddy struct {
-	ID           int64     `json:"-"`
-	Version      int       `json:"-"`
+	ID           int64     `json:"id"`
+	Version      int       `json:"version"`
 	CreatedAt    time.Time `json:"-"`
 	UpdatedAt    time.Time `json:"-"`
 	UserID       string    `json:"user_id"`
@@ -22,10 +45,37 @@ type Buddy struct {
 	Organisation *string   `json:"organisation"`
 	OrgMemberID  *string   `json:"org_member_id"`
 	Notes        *string   `json:"notes"`
+	Status       *string   `json:"status,omitempty"`
+}
+
+// BuddyRequest is a buddy request as seen by the Diver it was sent to. It only
+// identifies the requester, as the rest of the requester's Buddy record holds
+// the details that they keep about the recipient for their own use.
+type BuddyRequest struct {
+	ID        int64     `json:"id"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserID    string    `json:"user_id"`
+	Status    string    `json:"status"`
+}
+
+// Request returns the BuddyRequest view of the given Buddy, which must be linked
+// to another diver.
+func (b *Buddy) Request() *BuddyRequest {
+	return &BuddyRequest{
+		ID:        b.ID,
+		Version:   b.Version,
+		CreatedAt: b.CreatedAt,
+		UpdatedAt: b.UpdatedAt,
+		UserID:    b.UserID,
+		Status:    *b.Status,
+	}
 }
 
 type BuddyModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
 // ValidateBuddy validates a Buddy struct and stores any errors in the provided
@@ -58,18 +108,34 @@ func ValidateBuddy(v *validator.Validator, buddy *Buddy) {
 	}
 }
 
-// Insert adds the given Buddy into the database. If the email address (case
-// insensitive) already exists in the database, then an ErrDuplicateEmail
-// response will be returned.
-func (m BuddyModel) Insert(buddy *Buddy) error {
+// ValidateBuddyStatusTransition checks that a linked Buddy with the status from
+// can be moved to the status to and stores any errors in the provided
+// validator.Validator struct.
+func ValidateBuddyStatusTransition(v *validator.Validator, from *string, to string) {
+	if from == nil {
+		v.AddError("status", "Only linked buddies have a status")
+		return
+	}
+
+	v.Check(validator.PermittedValue(to, buddyStatusTransitions[*from]...), "status",
+		fmt.Sprintf("Cannot change from %s to %s", *from, to))
+}
+
+// Insert adds the given Buddy into the database. If the buddy has an email
+// address but is not linked to a diver, an Invitation for them that expires
+// after invitationTTL is created in the same transaction and returned, so that
+// the buddy is never added without one. Otherwise, the returned Invitation is
+// nil. If the diver already has a buddy with the same email address or linked
+// diver, then an ErrUniqueConstraintViolation will be returned.
+func (m BuddyModel) Insert(ctx context.Context, buddy *Buddy, invitationTTL time.Duration) (*Invitation, error) {
 	// The INSERT query returns the automatically generated values so that they
 	// can be added to the User struct.
 	query := `
 		insert into buddies (
 			user_id, name, email, phone_number, buddy_user_id, organisation,
-			org_member_id, notes
+			org_member_id, notes, status
 		)
-		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	 returning id, version, created_at, updated_at
 	`
 
@@ -82,52 +148,157 @@ func (m BuddyModel) Insert(buddy *Buddy) error {
 		buddy.Organisation,
 		buddy.OrgMemberID,
 		buddy.Notes,
+		buddy.Status,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
-	row := m.DB.QueryRowContext(ctx, query, args...)
-	err := row.Scan(&buddy.ID, &buddy.Version, &buddy.CreatedAt, &buddy.UpdatedAt)
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "buddies_user_id_buddy_user_id_key"`,
-			err.Error() == `pq: duplicate key value violates unique constraint "buddies_user_id_email_key"`:
-			return ErrDuplicateEmail
-		default:
-			return err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, query, args...)
+	err = row.Scan(&buddy.ID, &buddy.Version, &buddy.CreatedAt, &buddy.UpdatedAt)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	var inv *Invitation
+	if buddy.Email != nil && buddy.BuddyUserID == nil {
+		inv, err = insertInvitation(ctx, tx, buddy, invitationTTL)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
 }
 
-// GetAllForDiver queries the database for all the buddies of the Diver with the
-// given UserID.
-func (m BuddyModel) GetAllForDiver(userID string) ([]*Buddy, error) {
+// GetOneByID queries the database for the Buddy with the given ID. If no
+// matching record exists, ErrRecordNotFound is returned.
+func (m BuddyModel) GetOneByID(ctx context.Context, id int64) (*Buddy, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
 	query := `
 		select
 		    id, version, created_at, updated_at, user_id, buddy_user_id, name,
-			email, phone_number, organisation, org_member_id, notes
+			email, phone_number, organisation, org_member_id, notes, status
 		  from buddies
-		 where user_id = $1
-	  order by name desc
+		 where id = $1
 	`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	var buddy Buddy
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, userID)
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&buddy.ID,
+		&buddy.Version,
+		&buddy.CreatedAt,
+		&buddy.UpdatedAt,
+		&buddy.UserID,
+		&buddy.BuddyUserID,
+		&buddy.Name,
+		&buddy.Email,
+		&buddy.PhoneNumber,
+		&buddy.Organisation,
+		&buddy.OrgMemberID,
+		&buddy.Notes,
+		&buddy.Status,
+	)
+
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &buddy, nil
+}
+
+// BuddyFilters holds the optional filters for listing a diver's buddies. Empty
+// fields are not filtered on.
+type BuddyFilters struct {
+	Organisation string
+	Search       string
+}
+
+// searchQuery converts a free text search into a Postgres tsquery that matches
+// records containing words starting with every word in the search. Anything
+// other than letters and digits separates words, which also stops any tsquery
+// operators being passed through. An empty string is returned if the search
+// contains no words.
+func searchQuery(search string) string {
+	words := strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+// GetAllForDiver queries the database for a page of the buddies of the Diver
+// with the given UserID that match the given BuddyFilters. If the Organisation
+// filter is set, only buddies who are members of that organisation (case
+// insensitive) are returned. If the Search filter is set, the buddies' names,
+// email addresses, organisation details and notes are searched for words
+// starting with each of the words given, with the best matches returned first.
+// Results are then sorted and paginated according to the given Filters.
+func (m BuddyModel) GetAllForDiver(ctx context.Context, userID string, bf BuddyFilters, filters Filters) ([]*Buddy, Metadata, error) {
+	query := fmt.Sprintf(`
+		select
+		    count(*) over(), id, version, created_at, updated_at, user_id,
+			buddy_user_id, name, email, phone_number, organisation,
+			org_member_id, notes, status
+		  from buddies
+		 where user_id = $1
+		   and (lower(organisation) = lower($2) or $2 = '')
+		   and ($3 = '' or search @@ to_tsquery('simple', $3))
+	  order by ts_rank(search, to_tsquery('simple', $3)) desc, %s %s, id asc
+		 limit $4 offset $5
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{
+		userID,
+		bf.Organisation,
+		searchQuery(bf.Search),
+		filters.limit(),
+		filters.offset(),
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 	defer rows.Close()
 
+	totalRecords := 0
 	buddies := []*Buddy{}
 	for rows.Next() {
 		var buddy Buddy
 
 		err := rows.Scan(
+			&totalRecords,
 			&buddy.ID,
 			&buddy.Version,
 			&buddy.CreatedAt,
@@ -140,18 +311,482 @@ func (m BuddyModel) GetAllForDiver(userID string) ([]*Buddy, error) {
 			&buddy.Organisation,
 			&buddy.OrgMemberID,
 			&buddy.Notes,
+			&buddy.Status,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, err
 		}
 
 		buddies = append(buddies, &buddy)
 	}
 
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return buddies, metadata, nil
+}
+
+// Update updates the details of the given Buddy in the database, incrementing
+// its version and setting its updated_at time. The update will only succeed if
+// the version in the database still matches that of the given buddy, otherwise
+// ErrEditConflict is returned.
+func (m BuddyModel) Update(ctx context.Context, buddy *Buddy) error {
+	query := `
+		update buddies
+		   set name = $1, email = $2, phone_number = $3, buddy_user_id = $4,
+		       organisation = $5, org_member_id = $6, notes = $7, status = $8,
+		       version = version + 1, updated_at = now()
+		 where id = $9
+		   and version = $10
+	 returning version, updated_at
+	`
+
+	args := []any{
+		buddy.Name,
+		buddy.Email,
+		buddy.PhoneNumber,
+		buddy.BuddyUserID,
+		buddy.Organisation,
+		buddy.OrgMemberID,
+		buddy.Notes,
+		buddy.Status,
+		buddy.ID,
+		buddy.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&buddy.Version, &buddy.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// LinkByEmail links every unlinked Buddy record with the given email address to
+// the Diver with the given userID, replacing the buddy's name with the given
+// name from the diver's user account. The linked buddies become pending buddy
+// requests to the diver. A diver is never linked as their own buddy.
+//
+// Each record is linked on its own, so that a diver who already has a linked
+// record for the new diver does not stop everyone else's records from being
+// linked; those conflicting records are skipped and left unlinked. The number
+// of buddy records that were linked and skipped are returned.
+func (m BuddyModel) LinkByEmail(ctx context.Context, email, userID, name string) (linked, skipped int, err error) {
+	query := `
+		select id
+		  from buddies
+		 where email = $1
+		   and buddy_user_id is null
+		   and user_id <> $2
+	`
+
+	ids, err := m.queryIDs(ctx, query, email, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	query = `
+		update buddies
+		   set buddy_user_id = $1, name = $2, status = 'pending',
+		       version = version + 1, updated_at = now()
+		 where id = $3
+		   and buddy_user_id is null
+	`
+
+	for _, id := range ids {
+		n, err := m.exec(ctx, query, userID, name, id)
+		if err != nil {
+			var errUniqConstraint *sqldb.ErrUniqueConstraintViolation
+			if errors.As(translateError(err), &errUniqConstraint) {
+				skipped++
+				continue
+			}
+			return linked, skipped, err
+		}
+		linked += int(n)
+	}
+
+	return linked, skipped, nil
+}
+
+// queryIDs runs the given query, which must select a single ID column, and
+// returns the IDs that it found.
+func (m BuddyModel) queryIDs(ctx context.Context, query string, args ...any) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// exec runs the given statement and returns the number of rows it affected.
+func (m BuddyModel) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetOneByUsers queries the database for the Buddy record that the Diver with
+// the given userID holds for the linked Diver with the given buddyUserID. If no
+// matching record exists, ErrRecordNotFound is returned.
+func (m BuddyModel) GetOneByUsers(ctx context.Context, userID, buddyUserID string) (*Buddy, error) {
+	query := `
+		select
+		    id, version, created_at, updated_at, user_id, buddy_user_id, name,
+			email, phone_number, organisation, org_member_id, notes, status
+		  from buddies
+		 where user_id = $1
+		   and buddy_user_id = $2
+	`
+
+	var buddy Buddy
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, buddyUserID).Scan(
+		&buddy.ID,
+		&buddy.Version,
+		&buddy.CreatedAt,
+		&buddy.UpdatedAt,
+		&buddy.UserID,
+		&buddy.BuddyUserID,
+		&buddy.Name,
+		&buddy.Email,
+		&buddy.PhoneNumber,
+		&buddy.Organisation,
+		&buddy.OrgMemberID,
+		&buddy.Notes,
+		&buddy.Status,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &buddy, nil
+}
+
+// FindIDForDiver looks up the ID of the buddy of the Diver with the given
+// userID that has the given email address or, failing that, the given name,
+// ignoring case. Either may be empty to only match on the other. If no buddy
+// matches, ErrRecordNotFound is returned.
+func (m BuddyModel) FindIDForDiver(ctx context.Context, userID, name, email string) (int64, error) {
+	query := `
+		select id
+		  from buddies
+		 where user_id = $1
+		   and ((lower(email) = lower($2) and $2 != '')
+		        or (lower(name) = lower($3) and $3 != ''))
+	  order by lower(email) = lower($2) desc nulls last, id asc
+		 limit 1
+	`
+
+	var id int64
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, email, name).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// GetNamesForDiver queries the database for the names of all of the buddies of
+// the Diver with the given userID, keyed by the buddies' IDs.
+func (m BuddyModel) GetNamesForDiver(ctx context.Context, userID string) (map[int64]string, error) {
+	query := `
+		select id, name
+		  from buddies
+		 where user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var name string
+
+		err := rows.Scan(&id, &name)
+		if err != nil {
+			return nil, err
+		}
+
+		names[id] = name
+	}
+
+	return names, rows.Err()
+}
+
+// GetRequestsForDiver queries the database for all the buddy requests with the
+// given status that other divers have sent to the Diver with the given userID.
+func (m BuddyModel) GetRequestsForDiver(ctx context.Context, userID, status string) ([]*BuddyRequest, error) {
+	query := `
+		select id, version, created_at, updated_at, user_id, status
+		  from buddies
+		 where buddy_user_id = $1
+		   and status = $2
+	  order by created_at desc
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []*BuddyRequest{}
+	for rows.Next() {
+		var request BuddyRequest
+
+		err := rows.Scan(
+			&request.ID,
+			&request.Version,
+			&request.CreatedAt,
+			&request.UpdatedAt,
+			&request.UserID,
+			&request.Status,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, &request)
+	}
+
 	err = rows.Err()
 	if err != nil {
 		return nil, err
 	}
 
-	return buddies, nil
+	return requests, nil
+}
+
+// AcceptPending accepts the pending buddy request, if there is one, that the
+// Diver with the given userID has sent to the Diver with the given
+// buddyUserID. It is used when two divers send each other a buddy request.
+func (m BuddyModel) AcceptPending(ctx context.Context, userID, buddyUserID string) error {
+	query := `
+		update buddies
+		   set status = 'accepted', version = version + 1, updated_at = now()
+		 where user_id = $1
+		   and buddy_user_id = $2
+		   and status = 'pending'
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, buddyUserID)
+	return err
+}
+
+// Respond records the recipient's response to a buddy request by updating the
+// status of the given request, which must already be set to the new status. The
+// update will only succeed if the request's version in the database still
+// matches, otherwise ErrEditConflict is returned. If reciprocal is not nil, it
+// is stored as the recipient's own Buddy record for the requester, either by
+// updating their existing record for the requester or by inserting a new one.
+// All changes are made in a single transaction.
+func (m BuddyModel) Respond(ctx context.Context, request *Buddy, reciprocal *Buddy) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update buddies
+		   set status = $1, version = version + 1, updated_at = now()
+		 where id = $2
+		   and version = $3
+	 returning version, updated_at
+	`
+
+	args := []any{request.Status, request.ID, request.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&request.Version, &request.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	// Declining a request, including one that was previously blocked, removes
+	// any block that the recipient holds on the requester.
+	if *request.Status == BuddyStatusDeclined {
+		query = `
+			delete from buddies
+			 where user_id = $1
+			   and buddy_user_id = $2
+			   and status = 'blocked'
+		`
+
+		_, err = tx.ExecContext(ctx, query, request.BuddyUserID, request.UserID)
+		if err != nil {
+			return err
+		}
+	}
+
+	if reciprocal != nil {
+		// The recipient may already have a record for the requester, either
+		// linked or just using their email address, so prefer updating that.
+		query = `
+			update buddies
+			   set buddy_user_id = $1, status = $2, version = version + 1,
+			       updated_at = now()
+			 where id = (
+				select id
+				  from buddies
+				 where user_id = $3
+				   and (buddy_user_id = $1 or email = $4)
+			  order by buddy_user_id nulls last
+				 limit 1
+			 )
+		 returning id, version, created_at, updated_at, name
+		`
+
+		args = []any{
+			reciprocal.BuddyUserID,
+			reciprocal.Status,
+			reciprocal.UserID,
+			reciprocal.Email,
+		}
+
+		err = tx.QueryRowContext(ctx, query, args...).Scan(
+			&reciprocal.ID,
+			&reciprocal.Version,
+			&reciprocal.CreatedAt,
+			&reciprocal.UpdatedAt,
+			&reciprocal.Name,
+		)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			query = `
+				insert into buddies (
+					user_id, buddy_user_id, name, email, status
+				)
+				values ($1, $2, $3, $4, $5)
+			 returning id, version, created_at, updated_at
+			`
+
+			args = []any{
+				reciprocal.UserID,
+				reciprocal.BuddyUserID,
+				reciprocal.Name,
+				reciprocal.Email,
+				reciprocal.Status,
+			}
+
+			err = tx.QueryRowContext(ctx, query, args...).Scan(
+				&reciprocal.ID,
+				&reciprocal.Version,
+				&reciprocal.CreatedAt,
+				&reciprocal.UpdatedAt,
+			)
+		}
+
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the Buddy with the given ID belonging to the Diver with the
+// given userID from the database. If no matching record exists,
+// ErrRecordNotFound is returned.
+func (m BuddyModel) Delete(ctx context.Context, userID string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from buddies
+		 where id = $1
+		   and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
 }
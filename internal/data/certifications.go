@@ -0,0 +1,291 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// Certification represents a diving certification that a Diver holds for
+// having completed a course offered by a certification Agency. It can only be
+// signed by the instructor whose user ID is given in InstructorUserID.
+type Certification struct {
+	ID               int64          `json:"id"`
+	Version          int            `json:"version"`
+	CreatedAt        time.Time      `json:"-"`
+	UpdatedAt        time.Time      `json:"-"`
+	UserID           string         `json:"user_id"`
+	AgencyID         int64          `json:"agency_id"`
+	CourseID         int64          `json:"course_id"`
+	CourseName       string         `json:"course_name"`
+	CertNumber       *string        `json:"cert_number"`
+	IssueDate        jsonz.DateOnly `json:"issue_date"`
+	Instructor       *string        `json:"instructor"`
+	DiveCentre       *string        `json:"dive_centre"`
+	InstructorUserID *string        `json:"instructor_user_id"`
+	SignedBy         *string        `json:"signed_by,omitempty"`
+	SignedAt         *time.Time     `json:"signed_at,omitempty"`
+}
+
+type CertificationModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// ValidateCertification validates a Certification struct and stores any errors
+// in the provided validator.Validator struct. Checking that the course belongs
+// to the given agency requires a database lookup, so is left to the caller.
+func ValidateCertification(v *validator.Validator, cert *Certification) {
+	v.Check(validator.Matches(cert.UserID, validator.BetterGUIDRX),
+		"user_id", "Must be a valid BetterGUID")
+
+	v.Check(cert.AgencyID > 0, "agency_id", "Must be provided")
+	v.Check(cert.CourseID > 0, "course_id", "Must be provided")
+
+	v.Check(!cert.IssueDate.IsZero(), "issue_date", "Must be provided")
+	v.Check(cert.IssueDate.Before(time.Now()), "issue_date", "Must not be in the future")
+
+	if cert.CertNumber != nil {
+		validator.ValidateStrLenRune(v, *cert.CertNumber, "cert_number", 1, 64)
+	}
+
+	if cert.Instructor != nil {
+		validator.ValidateStrLenRune(v, *cert.Instructor, "instructor", 2, 256)
+	}
+
+	if cert.DiveCentre != nil {
+		validator.ValidateStrLenRune(v, *cert.DiveCentre, "dive_centre", 2, 256)
+	}
+
+	if cert.InstructorUserID != nil {
+		v.Check(validator.Matches(*cert.InstructorUserID, validator.BetterGUIDRX),
+			"instructor_user_id", "Must be a valid BetterGUID")
+		v.Check(*cert.InstructorUserID != cert.UserID,
+			"instructor_user_id", "Must not be your own user ID")
+	}
+}
+
+// Insert adds the given Certification into the database. If the diver already
+// holds a certification for the same course, then an
+// ErrUniqueConstraintViolation will be returned.
+func (m CertificationModel) Insert(ctx context.Context, cert *Certification) error {
+	query := `
+		insert into certifications (
+			user_id, course_id, cert_number, issue_date, instructor,
+			dive_centre, instructor_user_id
+		)
+		values ($1, $2, $3, $4, $5, $6, $7)
+	 returning id, version, created_at, updated_at
+	`
+
+	args := []any{
+		cert.UserID,
+		cert.CourseID,
+		cert.CertNumber,
+		cert.IssueDate,
+		cert.Instructor,
+		cert.DiveCentre,
+		cert.InstructorUserID,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, query, args...)
+	err := row.Scan(&cert.ID, &cert.Version, &cert.CreatedAt, &cert.UpdatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// GetOneByID queries the database for the Certification with the given ID. If
+// no matching record exists, ErrRecordNotFound is returned.
+func (m CertificationModel) GetOneByID(ctx context.Context, id int64) (*Certification, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select
+		      c.id, c.version, c.created_at, c.updated_at, c.user_id,
+		      ac.agency_id, c.course_id, ac.name, c.cert_number, c.issue_date,
+		      c.instructor, c.dive_centre, c.instructor_user_id, c.signed_by,
+		      c.signed_at
+		 from certifications c
+		 join agency_courses ac on ac.id = c.course_id
+		where c.id = $1
+	`
+
+	var cert Certification
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&cert.ID,
+		&cert.Version,
+		&cert.CreatedAt,
+		&cert.UpdatedAt,
+		&cert.UserID,
+		&cert.AgencyID,
+		&cert.CourseID,
+		&cert.CourseName,
+		&cert.CertNumber,
+		&cert.IssueDate,
+		&cert.Instructor,
+		&cert.DiveCentre,
+		&cert.InstructorUserID,
+		&cert.SignedBy,
+		&cert.SignedAt,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &cert, nil
+}
+
+// GetAllForDiver queries the database for all the certifications held by the
+// Diver with the given UserID, most recently issued first.
+func (m CertificationModel) GetAllForDiver(ctx context.Context, userID string) ([]*Certification, error) {
+	query := `
+		select
+		       c.id, c.version, c.created_at, c.updated_at, c.user_id,
+		       ac.agency_id, c.course_id, ac.name, c.cert_number, c.issue_date,
+		       c.instructor, c.dive_centre, c.instructor_user_id, c.signed_by,
+		       c.signed_at
+		  from certifications c
+		  join agency_courses ac on ac.id = c.course_id
+		 where c.user_id = $1
+	  order by c.issue_date desc
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	certs := []*Certification{}
+	for rows.Next() {
+		var cert Certification
+
+		err := rows.Scan(
+			&cert.ID,
+			&cert.Version,
+			&cert.CreatedAt,
+			&cert.UpdatedAt,
+			&cert.UserID,
+			&cert.AgencyID,
+			&cert.CourseID,
+			&cert.CourseName,
+			&cert.CertNumber,
+			&cert.IssueDate,
+			&cert.Instructor,
+			&cert.DiveCentre,
+			&cert.InstructorUserID,
+			&cert.SignedBy,
+			&cert.SignedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		certs = append(certs, &cert)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+// Sign records that the Certification has been verified by the instructor with
+// the given userID. The update will only succeed if the certification has not
+// already been signed and its version in the database still matches that of
+// the given cert, otherwise ErrEditConflict is returned. On success, the cert's
+// signature and Version fields are updated.
+func (m CertificationModel) Sign(ctx context.Context, cert *Certification, userID string) error {
+	query := `
+		update certifications
+		   set signed_by = $1, signed_at = now(), version = version + 1,
+		       updated_at = now()
+		 where id = $2
+		   and version = $3
+		   and signed_by is null
+	 returning signed_by, signed_at, version, updated_at
+	`
+
+	args := []any{userID, cert.ID, cert.Version}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&cert.SignedBy,
+		&cert.SignedAt,
+		&cert.Version,
+		&cert.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the Certification with the given ID held by the Diver with the
+// given userID from the database. If no matching record exists,
+// ErrRecordNotFound is returned.
+func (m CertificationModel) Delete(ctx context.Context, userID string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from certifications
+		 where id = $1
+		   and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/profile"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// maxProfileSamples is the largest number of samples that a dive's profile may
+// have, which is one a second for a whole day.
+const maxProfileSamples = 86400
+
+// ValidateProfile validates the samples of a dive's profile and stores any
+// errors in the provided validator.Validator struct.
+func ValidateProfile(v *validator.Validator, samples []profile.Sample) {
+	v.Check(len(samples) <= maxProfileSamples, "samples", "Must contain a maximum of 86400 samples")
+
+	for i, s := range samples {
+		if i > 0 && s.Elapsed <= samples[i-1].Elapsed {
+			v.AddError("samples", "Must be in order of elapsed time without duplicates")
+		}
+		if s.Elapsed < 0 || s.Depth < 0 || s.Depth > 350 {
+			v.AddError("samples", "Must only contain valid times and depths")
+		}
+		if s.Temperature != nil && (*s.Temperature < -3 || *s.Temperature > 45) {
+			v.AddError("samples", "Must only contain temperatures between -3 and 45 degrees")
+		}
+		if s.Pressure != nil && (*s.Pressure < 0 || *s.Pressure > 400) {
+			v.AddError("samples", "Must only contain tank pressures between 0 and 400 bar")
+		}
+		if s.PPO2 != nil && (*s.PPO2 < 0 || *s.PPO2 > 5) {
+			v.AddError("samples", "Must only contain ppO2 values between 0 and 5 bar")
+		}
+	}
+}
+
+// profileSummaryColumns scans the summary columns of a dive_profiles row that
+// has been left joined to a dive, which are all null if the dive has no
+// profile.
+type profileSummaryColumns struct {
+	samples          sql.NullInt64
+	duration         sql.NullInt64
+	maxDepth         sql.NullFloat64
+	avgDepth         sql.NullFloat64
+	maxAscentRate    sql.NullFloat64
+	ascentViolations sql.NullInt64
+}
+
+// dest returns the destinations to pass to Scan for the columns sample_count,
+// duration, max_depth, avg_depth, max_ascent_rate and ascent_violations, in
+// that order.
+func (c *profileSummaryColumns) dest() []any {
+	return []any{
+		&c.samples,
+		&c.duration,
+		&c.maxDepth,
+		&c.avgDepth,
+		&c.maxAscentRate,
+		&c.ascentViolations,
+	}
+}
+
+// summary returns the scanned profile.Summary, or nil if there was none.
+func (c *profileSummaryColumns) summary() *profile.Summary {
+	if !c.samples.Valid {
+		return nil
+	}
+
+	return &profile.Summary{
+		Samples:          int(c.samples.Int64),
+		Duration:         int(c.duration.Int64),
+		MaxDepth:         c.maxDepth.Float64,
+		AvgDepth:         c.avgDepth.Float64,
+		MaxAscentRate:    c.maxAscentRate.Float64,
+		AscentViolations: int(c.ascentViolations.Int64),
+	}
+}
+
+// setDiveProfile encodes and saves the given samples as the profile of the Dive
+// with the given ID along with their summary, replacing any existing profile.
+// If there are no samples, any existing profile is deleted and nil is
+// returned.
+func setDiveProfile(ctx context.Context, tx *sql.Tx, diveID int64, samples []profile.Sample) (*profile.Summary, error) {
+	if len(samples) == 0 {
+		_, err := tx.ExecContext(ctx, `delete from dive_profiles where dive_id = $1`, diveID)
+		return nil, err
+	}
+
+	summary := profile.Summarise(samples)
+
+	query := `
+		insert into dive_profiles (
+			dive_id, samples, sample_count, duration, max_depth, avg_depth,
+			max_ascent_rate, ascent_violations
+		)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+		    on conflict (dive_id) do update
+		   set samples = excluded.samples,
+		       sample_count = excluded.sample_count,
+		       duration = excluded.duration,
+		       max_depth = excluded.max_depth,
+		       avg_depth = excluded.avg_depth,
+		       max_ascent_rate = excluded.max_ascent_rate,
+		       ascent_violations = excluded.ascent_violations,
+		       updated_at = now()
+	`
+
+	args := []any{
+		diveID,
+		profile.Encode(samples),
+		summary.Samples,
+		summary.Duration,
+		summary.MaxDepth,
+		summary.AvgDepth,
+		summary.MaxAscentRate,
+		summary.AscentViolations,
+	}
+
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	return &summary, nil
+}
+
+// SetProfile replaces the profile of the given Dive with its Samples and sets
+// its Profile to their summary, updating its SAC to match. If it has no
+// samples, its profile is deleted. As the summary is part of the dive, its
+// version is incremented, and the change will only succeed if the version in
+// the database still matches that of the dive. Otherwise, an ErrEditConflict
+// is returned.
+func (m DiveModel) SetProfile(ctx context.Context, dive *Dive) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update dives
+		   set version = version + 1, updated_at = now()
+		 where id = $1
+		   and version = $2
+	 returning version, updated_at
+	`
+
+	err = tx.QueryRowContext(ctx, query, dive.ID, dive.Version).Scan(&dive.Version, &dive.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	dive.Profile, err = setDiveProfile(ctx, tx, dive.ID, dive.Samples)
+	if err != nil {
+		return err
+	}
+
+	dive.setSAC()
+
+	return tx.Commit()
+}
+
+// GetProfile queries the database for the profile of the Dive with the given
+// ID and decodes it. If the dive has no profile, ErrRecordNotFound
+// is returned.
+func (m DiveModel) GetProfile(ctx context.Context, diveID int64) ([]profile.Sample, error) {
+	query := `
+		select samples
+		  from dive_profiles
+		 where dive_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var encoded []byte
+	err := m.DB.QueryRowContext(ctx, query, diveID).Scan(&encoded)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return profile.Decode(encoded)
+}
@@ -0,0 +1,376 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// The ways in which a DiveSite can be entered.
+const (
+	SiteEntryShore = "shore"
+	SiteEntryBoat  = "boat"
+	SiteEntryPier  = "pier"
+)
+
+// earthRadiusKm is the mean radius of the Earth in kilometres, which is used
+// to work out the great-circle distance between two points.
+const earthRadiusKm = 6371.0088
+
+// kmPerDegreeLat is the approximate distance in kilometres covered by one
+// degree of latitude.
+const kmPerDegreeLat = 111.2
+
+// DiveSite represents a dive site in the shared catalogue that any diver can
+// refer to from their dives and trips. The latitude and longitude are in
+// decimal degrees and the maximum depth is in metres. The Distance field is
+// only set on the results of a proximity search and holds the distance in
+// kilometres from the point that was searched for.
+type DiveSite struct {
+	ID          int64     `json:"id"`
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"-"`
+	UpdatedAt   time.Time `json:"-"`
+	CreatedBy   *string   `json:"created_by,omitempty"`
+	Name        string    `json:"name"`
+	Country     string    `json:"country"`
+	Region      *string   `json:"region,omitempty"`
+	Latitude    float64   `json:"latitude"`
+	Longitude   float64   `json:"longitude"`
+	MaxDepth    *float64  `json:"max_depth,omitempty"`
+	EntryType   *string   `json:"entry_type,omitempty"`
+	Description *string   `json:"description,omitempty"`
+	Distance    *float64  `json:"distance,omitempty"`
+}
+
+// DiveSiteFilters holds the optional filters for searching the catalogue of
+// dive sites by name.
+type DiveSiteFilters struct {
+	Country string
+	Search  string
+}
+
+type DiveSiteModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// ValidateDiveSite validates a DiveSite struct and stores any errors in the
+// provided validator.Validator struct.
+func ValidateDiveSite(v *validator.Validator, site *DiveSite) {
+	validator.ValidateStrLenRune(v, site.Name, "name", 2, 256)
+
+	// TODO: Ensure the country code is a valid option.
+	v.Check(len(site.Country) == 2, "country", "Must be exactly two bytes long")
+
+	if site.Region != nil {
+		validator.ValidateStrLenRune(v, *site.Region, "region", 2, 256)
+	}
+
+	ValidateCoordinates(v, site.Latitude, site.Longitude)
+
+	if site.MaxDepth != nil {
+		v.Check(*site.MaxDepth > 0, "max_depth", "Must be greater than zero")
+		v.Check(*site.MaxDepth <= 350, "max_depth", "Must be a maximum of 350 metres")
+	}
+
+	if site.EntryType != nil {
+		v.Check(validator.PermittedValue(*site.EntryType, SiteEntryShore, SiteEntryBoat, SiteEntryPier),
+			"entry_type", "Must be one of shore, boat or pier")
+	}
+
+	if site.Description != nil {
+		validator.ValidateStrLenRune(v, *site.Description, "description", 1, 8192)
+	}
+}
+
+// ValidateCoordinates checks that the given latitude and longitude in decimal
+// degrees describe a point on the Earth and stores any errors in the provided
+// validator.Validator struct.
+func ValidateCoordinates(v *validator.Validator, lat, lon float64) {
+	v.Check(lat >= -90 && lat <= 90, "latitude", "Must be between -90 and 90 degrees")
+	v.Check(lon >= -180 && lon <= 180, "longitude", "Must be between -180 and 180 degrees")
+}
+
+// Insert adds the given DiveSite into the database. If a site with the same
+// name already exists in the same country, then an
+// ErrUniqueConstraintViolation will be returned.
+func (m DiveSiteModel) Insert(ctx context.Context, site *DiveSite) error {
+	query := `
+		insert into dive_sites (
+			created_by, name, country, region, latitude, longitude, max_depth,
+			entry_type, description
+		)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	 returning id, version, created_at, updated_at
+	`
+
+	args := []any{
+		site.CreatedBy,
+		site.Name,
+		site.Country,
+		site.Region,
+		site.Latitude,
+		site.Longitude,
+		site.MaxDepth,
+		site.EntryType,
+		site.Description,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	row := m.DB.QueryRowContext(ctx, query, args...)
+	err := row.Scan(&site.ID, &site.Version, &site.CreatedAt, &site.UpdatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// GetOneByID queries the database for the DiveSite with the given ID. If no
+// matching record exists, ErrRecordNotFound is returned.
+func (m DiveSiteModel) GetOneByID(ctx context.Context, id int64) (*DiveSite, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select
+		       id, version, created_at, updated_at, created_by, name, country,
+		       region, latitude, longitude, max_depth, entry_type, description
+		  from dive_sites
+		 where id = $1
+	`
+
+	var site DiveSite
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&site.ID,
+		&site.Version,
+		&site.CreatedAt,
+		&site.UpdatedAt,
+		&site.CreatedBy,
+		&site.Name,
+		&site.Country,
+		&site.Region,
+		&site.Latitude,
+		&site.Longitude,
+		&site.MaxDepth,
+		&site.EntryType,
+		&site.Description,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &site, nil
+}
+
+// GetAll queries the database for a page of the dive sites that match the
+// given DiveSiteFilters. If the Country filter is set, only sites in that
+// country are returned. If the Search filter is set, the sites' names and
+// regions are searched for words starting with each of the words given, with
+// the best matches returned first. Results are then sorted and paginated
+// according to the given Filters.
+func (m DiveSiteModel) GetAll(ctx context.Context, sf DiveSiteFilters, filters Filters) ([]*DiveSite, Metadata, error) {
+	query := fmt.Sprintf(`
+		select
+		       count(*) over(), id, version, created_at, updated_at, created_by,
+		       name, country, region, latitude, longitude, max_depth,
+		       entry_type, description, null
+		  from dive_sites
+		 where (upper(country) = upper($1) or $1 = '')
+		   and ($2 = '' or search @@ to_tsquery('simple', $2))
+	  order by ts_rank(search, to_tsquery('simple', $2)) desc, %s %s, id asc
+		 limit $3 offset $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{
+		sf.Country,
+		searchQuery(sf.Search),
+		filters.limit(),
+		filters.offset(),
+	}
+
+	return m.getAll(ctx, query, args, filters)
+}
+
+// GetAllNear queries the database for a page of the dive sites within radius
+// kilometres of the point at the given latitude and longitude, nearest first.
+// The Distance field of each site is set to its distance from the point.
+func (m DiveSiteModel) GetAllNear(ctx context.Context, lat, lon, radius float64, filters Filters) ([]*DiveSite, Metadata, error) {
+	// The distances are worked out with the haversine formula, capping the
+	// argument to asin at 1 in case rounding errors push it over. Sites outside
+	// the band of latitudes that the radius could reach are ruled out first,
+	// so that the index on the latitude can be used.
+	query := fmt.Sprintf(`
+		with nearby as (
+			select
+			       *,
+			       2 * %[1]f * asin(least(1, sqrt(
+			           power(sin(radians(latitude - $1) / 2), 2) +
+			           cos(radians($1)) * cos(radians(latitude)) *
+			           power(sin(radians(longitude - $2) / 2), 2)
+			       ))) as distance
+			  from dive_sites
+			 where latitude between $1 - $3::float8 / %[2]f
+			                      and $1 + $3::float8 / %[2]f
+		)
+		select
+		       count(*) over(), id, version, created_at, updated_at, created_by,
+		       name, country, region, latitude, longitude, max_depth,
+		       entry_type, description, distance
+		  from nearby
+		 where distance <= $3
+	  order by distance asc, id asc
+		 limit $4 offset $5
+	`, earthRadiusKm, kmPerDegreeLat)
+
+	args := []any{lat, lon, radius, filters.limit(), filters.offset()}
+
+	return m.getAll(ctx, query, args, filters)
+}
+
+// getAll runs the given query for a page of dive sites and scans the results.
+// The query must return the total number of matching records in the first
+// column, followed by the fields of the DiveSite in order, ending with the
+// Distance, which may be null.
+func (m DiveSiteModel) getAll(ctx context.Context, query string, args []any, filters Filters) ([]*DiveSite, Metadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	sites := []*DiveSite{}
+	for rows.Next() {
+		var site DiveSite
+
+		err := rows.Scan(
+			&totalRecords,
+			&site.ID,
+			&site.Version,
+			&site.CreatedAt,
+			&site.UpdatedAt,
+			&site.CreatedBy,
+			&site.Name,
+			&site.Country,
+			&site.Region,
+			&site.Latitude,
+			&site.Longitude,
+			&site.MaxDepth,
+			&site.EntryType,
+			&site.Description,
+			&site.Distance,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		sites = append(sites, &site)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sites, metadata, nil
+}
+
+// Update updates the details of the given DiveSite in the database. The update
+// will only succeed if the version in the database still matches that of the
+// given site, otherwise ErrEditConflict is returned.
+func (m DiveSiteModel) Update(ctx context.Context, site *DiveSite) error {
+	query := `
+		update dive_sites
+		   set name = $1, country = $2, region = $3, latitude = $4,
+		       longitude = $5, max_depth = $6, entry_type = $7,
+		       description = $8, version = version + 1, updated_at = now()
+		 where id = $9
+		   and version = $10
+	 returning version, updated_at
+	`
+
+	args := []any{
+		site.Name,
+		site.Country,
+		site.Region,
+		site.Latitude,
+		site.Longitude,
+		site.MaxDepth,
+		site.EntryType,
+		site.Description,
+		site.ID,
+		site.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&site.Version, &site.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// Delete removes the DiveSite with the given ID from the database. If no
+// matching record exists, ErrRecordNotFound is returned. If any dives or trips
+// still refer to the site, ErrRecordInUse is returned.
+func (m DiveSiteModel) Delete(ctx context.Context, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from dive_sites
+		 where id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return translateDeleteError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -10,15 +10,11 @@ import (
 	"github.com/m5lapp/go-service-toolkit/validator"
 )
 
-var (
-	ErrDuplicateEmail = errors.New("duplicate email")
-)
-
 // Diver represents a human diver who is a user of the go-dive system. It embeds
 // a standard User struct and adds some additional fields.
 type Diver struct {
 	UserID               string          `json:"user_id"`
-	Version              int             `json:"-"`
+	Version              int             `json:"version"`
 	DivingSince          *jsonz.DateOnly `json:"diving_since"`
 	DiveNumberOffset     int             `json:"dive_number_offset"`
 	DefaultDivingCountry *string         `json:"default_diving_country"`
@@ -36,10 +32,29 @@ type DiverUser struct {
 	CountryCode  *string         `json:"country_code,omitempty"`
 	TimeZone     *string         `json:"time_zone,omitempty"`
 	Diver
+	// SAC is the diver's rolling average SAC rate, which is not stored but
+	// worked out from their recent dives.
+	SAC *DiverSAC `json:"sac,omitempty"`
+}
+
+// NewDiverUser combines the given User from the User service with the given
+// Diver record into a DiverUser.
+func NewDiverUser(user *User, diver *Diver) *DiverUser {
+	return &DiverUser{
+		Email:        user.Email,
+		Name:         user.Name,
+		FriendlyName: user.FriendlyName,
+		BirthDate:    user.BirthDate,
+		Gender:       user.Gender,
+		CountryCode:  user.CountryCode,
+		TimeZone:     user.TimeZone,
+		Diver:        *diver,
+	}
 }
 
 type DiverModel struct {
-	DB *sql.DB
+	DB       *sql.DB
+	Timeouts Timeouts
 }
 
 // ValidateDiver validates a Diver struct and stores any errors in the provided
@@ -69,10 +84,10 @@ func ValidateDiver(v *validator.Validator, diver *Diver) {
 	}
 }
 
-// Insert adds the given Diver into the database. If the email address (case
-// insensitive) already exists in the database, then an ErrDuplicateEmail
-// response will be returned.
-func (m DiverModel) Insert(diver *Diver) error {
+// Insert adds the given Diver into the database. If a diver with the same
+// UserID already exists in the database, then an ErrUniqueConstraintViolation
+// will be returned.
+func (m DiverModel) Insert(ctx context.Context, diver *Diver) error {
 	// The INSERT query returns the automatically generated values so that they
 	// can be added to the User struct.
 	query := `
@@ -92,18 +107,13 @@ func (m DiverModel) Insert(diver *Diver) error {
 		diver.DefaultDivingTZ,
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, args...)
 	err := row.Scan(&diver.Version)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "divers_pkey"`:
-			return ErrDuplicateEmail
-		default:
-			return err
-		}
+		return translateError(err)
 	}
 
 	return nil
@@ -111,7 +121,7 @@ func (m DiverModel) Insert(diver *Diver) error {
 
 // GetByID queries the database for a diver record with the given User ID.
 // If no matching record exists, ErrRecordNotFound is returned.
-func (m DiverModel) GetByID(id string) (*Diver, error) {
+func (m DiverModel) GetByID(ctx context.Context, id string) (*Diver, error) {
 	query := `
 		select
 		    user_id, version, diving_since, dive_number_offset,
@@ -122,7 +132,7 @@ func (m DiverModel) GetByID(id string) (*Diver, error) {
 
 	var diver Diver
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, id).Scan(
@@ -145,3 +155,43 @@ func (m DiverModel) GetByID(id string) (*Diver, error) {
 
 	return &diver, nil
 }
+
+// Update updates the Diver-specific fields of the given Diver in the database.
+// The update will only succeed if the version in the database still matches
+// that of the given diver, otherwise ErrEditConflict is returned. On success,
+// the diver's Version field is updated to the new value.
+func (m DiverModel) Update(ctx context.Context, diver *Diver) error {
+	query := `
+		update divers
+		   set diving_since = $1, dive_number_offset = $2,
+		       default_diving_country = $3, default_diving_timezone = $4,
+		       version = version + 1
+		 where user_id = $5
+		   and version = $6
+	 returning version
+	`
+
+	args := []any{
+		diver.DivingSince,
+		diver.DiveNumberOffset,
+		diver.DefaultDivingCountry,
+		diver.DefaultDivingTZ,
+		diver.UserID,
+		diver.Version,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&diver.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
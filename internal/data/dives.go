@@ -0,0 +1,782 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/m5lapp/go-dive-diver-service/internal/profile"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// Dive represents a single entry in a Diver's log book. Depths are in metres,
+// the bottom time is in minutes and the water temperature is in degrees
+// Celsius. The Number of a dive is not stored, but worked out as the diver's
+// DiveNumberOffset plus the position of the dive among all of their logged
+// dives in the order that they started.
+type Dive struct {
+	ID         int64     `json:"id"`
+	Version    int       `json:"version"`
+	CreatedAt  time.Time `json:"-"`
+	UpdatedAt  time.Time `json:"-"`
+	UserID     string    `json:"user_id"`
+	Number     int       `json:"number"`
+	StartedAt  time.Time `json:"started_at"`
+	Site       *string   `json:"site,omitempty"`
+	SiteID     *int64    `json:"site_id,omitempty"`
+	MaxDepth   float64   `json:"max_depth"`
+	BottomTime int       `json:"bottom_time"`
+	WaterTemp  *float64  `json:"water_temperature,omitempty"`
+	TripID     *int64    `json:"trip_id,omitempty"`
+	BuddyIDs   []int64   `json:"buddy_ids"`
+	// Cylinders are listed in the order that they were recorded.
+	Cylinders []DiveCylinder `json:"cylinders"`
+	// Profile summarises the dive's profile, if it has one. It is worked out
+	// when the profile is saved and cannot be changed directly.
+	Profile *profile.Summary `json:"profile,omitempty"`
+	// SAC is worked out from the Cylinders and Profile, if they record how much
+	// gas was used.
+	SAC *SACRate `json:"sac,omitempty"`
+	// Samples are only saved when the dive is inserted or its profile is set,
+	// and are fetched separately with GetProfile.
+	Samples []profile.Sample `json:"-"`
+}
+
+// DiveCylinder is a cylinder that was breathed from on a Dive. The size is the
+// water capacity in litres, pressures are in bar and the O2 and He fields are
+// the percentages of oxygen and helium in the gas.
+type DiveCylinder struct {
+	Description   *string  `json:"description,omitempty"`
+	Size          *float64 `json:"size,omitempty"`
+	WorkPressure  *float64 `json:"work_pressure,omitempty"`
+	StartPressure *float64 `json:"start_pressure,omitempty"`
+	EndPressure   *float64 `json:"end_pressure,omitempty"`
+	O2            float64  `json:"o2"`
+	He            float64  `json:"he"`
+}
+
+// UnmarshalJSON decodes a DiveCylinder from JSON, taking it to contain air if
+// no O2 percentage is given.
+func (cyl *DiveCylinder) UnmarshalJSON(b []byte) error {
+	type diveCylinder DiveCylinder
+
+	c := diveCylinder{O2: 21}
+	err := json.Unmarshal(b, &c)
+	if err != nil {
+		return err
+	}
+
+	*cyl = DiveCylinder(c)
+
+	return nil
+}
+
+type DiveModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// ValidateDive validates a Dive struct and stores any errors in the provided
+// validator.Validator struct. Checking that the buddies belong to the diver
+// requires a database lookup, so is done when the dive is saved.
+func ValidateDive(v *validator.Validator, dive *Dive) {
+	v.Check(!dive.StartedAt.IsZero(), "started_at", "Must be provided")
+	v.Check(dive.StartedAt.Before(time.Now()), "started_at", "Must not be in the future")
+
+	if dive.Site != nil {
+		validator.ValidateStrLenRune(v, *dive.Site, "site", 2, 256)
+	}
+
+	v.Check(dive.MaxDepth > 0, "max_depth", "Must be greater than zero")
+	v.Check(dive.MaxDepth <= 350, "max_depth", "Must be a maximum of 350 metres")
+
+	v.Check(dive.BottomTime > 0, "bottom_time", "Must be greater than zero")
+	v.Check(dive.BottomTime <= 1440, "bottom_time", "Must be a maximum of 1440 minutes")
+
+	if dive.WaterTemp != nil {
+		v.Check(*dive.WaterTemp >= -3, "water_temperature", "Must be at least -3 degrees")
+		v.Check(*dive.WaterTemp <= 45, "water_temperature", "Must be a maximum of 45 degrees")
+	}
+
+	if dive.SiteID != nil {
+		v.Check(*dive.SiteID > 0, "site_id", "Must be a valid dive site ID")
+	}
+
+	if dive.TripID != nil {
+		v.Check(*dive.TripID > 0, "trip_id", "Must be a valid trip ID")
+	}
+
+	ValidateProfile(v, dive.Samples)
+
+	v.Check(len(dive.Cylinders) <= 10, "cylinders", "Must contain a maximum of 10 cylinders")
+	for _, cyl := range dive.Cylinders {
+		ValidateDiveCylinder(v, &cyl)
+	}
+
+	v.Check(len(dive.BuddyIDs) <= 50, "buddy_ids", "Must contain a maximum of 50 buddies")
+	v.Check(validator.Unique(dive.BuddyIDs), "buddy_ids", "Must not contain duplicate buddies")
+	for _, id := range dive.BuddyIDs {
+		v.Check(id > 0, "buddy_ids", "Must only contain valid buddy IDs")
+	}
+}
+
+// ValidateDiveCylinder validates a DiveCylinder struct and stores any errors in
+// the provided validator.Validator struct.
+func ValidateDiveCylinder(v *validator.Validator, cyl *DiveCylinder) {
+	if cyl.Description != nil {
+		validator.ValidateStrLenRune(v, *cyl.Description, "cylinders", 1, 64)
+	}
+
+	if cyl.Size != nil {
+		v.Check(*cyl.Size > 0 && *cyl.Size <= 50, "cylinders", "Must have a size between 0 and 50 litres")
+	}
+
+	for _, p := range []*float64{cyl.WorkPressure, cyl.StartPressure, cyl.EndPressure} {
+		if p != nil {
+			v.Check(*p >= 0 && *p <= 400, "cylinders", "Must have pressures between 0 and 400 bar")
+		}
+	}
+
+	if cyl.StartPressure != nil && cyl.EndPressure != nil {
+		v.Check(*cyl.EndPressure <= *cyl.StartPressure, "cylinders",
+			"Must not have an end pressure higher than the start pressure")
+	}
+
+	v.Check(cyl.O2 >= 0 && cyl.O2 <= 100, "cylinders", "Must have an O2 percentage between 0 and 100")
+	v.Check(cyl.He >= 0 && cyl.He <= 100, "cylinders", "Must have an He percentage between 0 and 100")
+	v.Check(cyl.O2+cyl.He <= 100, "cylinders", "Must not have more than 100% O2 and He combined")
+}
+
+// buddyLink describes a join table that links records to the buddies of the
+// diver who owns them. The field is the name of the request field holding the
+// buddy IDs, which any errors are reported against.
+type buddyLink struct {
+	table  string
+	column string
+	field  string
+}
+
+var diveBuddiesLink = buddyLink{table: "dive_buddies", column: "dive_id", field: "buddy_ids"}
+
+// setBuddyLinks replaces the buddies linked to the record with the given id in
+// the given join table with those in buddyIDs. Every buddy must belong to the
+// diver with the given userID, otherwise an ErrForeignKeyViolation is
+// returned.
+func setBuddyLinks(ctx context.Context, tx *sql.Tx, link buddyLink, id int64, userID string, buddyIDs []int64) error {
+	query := fmt.Sprintf(`
+		delete from %s
+		 where %s = $1
+	`, link.table, link.column)
+
+	_, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	if len(buddyIDs) == 0 {
+		return nil
+	}
+
+	query = fmt.Sprintf(`
+		insert into %s (%s, buddy_id)
+		select $1, id
+		  from buddies
+		 where id = any($2)
+		   and user_id = $3
+	`, link.table, link.column)
+
+	result, err := tx.ExecContext(ctx, query, id, pq.Array(buddyIDs), userID)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected != int64(len(buddyIDs)) {
+		return &ErrForeignKeyViolation{
+			Table:      link.table,
+			Constraint: link.table + "_buddy_id_fkey",
+			Columns:    []string{link.field},
+		}
+	}
+
+	return nil
+}
+
+// checkDiveTrip makes sure that the trip the given Dive is attached to, if
+// any, belongs to the diver who logged the dive. If not, an
+// ErrForeignKeyViolation is returned.
+func checkDiveTrip(ctx context.Context, tx *sql.Tx, dive *Dive) error {
+	if dive.TripID == nil {
+		return nil
+	}
+
+	query := `
+		select exists (
+			select 1
+			  from trips
+			 where id = $1
+			   and user_id = $2
+		)
+	`
+
+	var exists bool
+	err := tx.QueryRowContext(ctx, query, *dive.TripID, dive.UserID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return &ErrForeignKeyViolation{
+			Table:      "dives",
+			Constraint: "dives_trip_id_fkey",
+			Columns:    []string{"trip_id"},
+		}
+	}
+
+	return nil
+}
+
+// setDiveCylinders replaces the cylinders of the given Dive in the database
+// with its Cylinders, in the order that they are given.
+func setDiveCylinders(ctx context.Context, tx *sql.Tx, dive *Dive) error {
+	_, err := tx.ExecContext(ctx, `delete from dive_cylinders where dive_id = $1`, dive.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		insert into dive_cylinders (
+			dive_id, position, description, size, work_pressure,
+			start_pressure, end_pressure, o2, he
+		)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	for i, cyl := range dive.Cylinders {
+		args := []any{
+			dive.ID,
+			i,
+			cyl.Description,
+			cyl.Size,
+			cyl.WorkPressure,
+			cyl.StartPressure,
+			cyl.EndPressure,
+			cyl.O2,
+			cyl.He,
+		}
+
+		_, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+// setDiveNumber works out the Number of the given Dive from the diver's
+// DiveNumberOffset and the number of dives that they logged up to and
+// including it.
+func setDiveNumber(ctx context.Context, tx *sql.Tx, dive *Dive) error {
+	query := `
+		select dv.dive_number_offset + count(*)
+		  from dives d
+		  join divers dv on dv.user_id = d.user_id
+		 where d.user_id = $1
+		   and (d.started_at, d.id) <= ($2, $3)
+	  group by dv.dive_number_offset
+	`
+
+	return tx.QueryRowContext(ctx, query, dive.UserID, dive.StartedAt, dive.ID).Scan(&dive.Number)
+}
+
+// Insert adds the given Dive and its buddies into the database. If any of the
+// buddies do not belong to the diver, an ErrForeignKeyViolation is returned
+// and nothing is saved.
+func (m DiveModel) Insert(ctx context.Context, dive *Dive) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkDiveTrip(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		insert into dives (
+			user_id, started_at, site, site_id, max_depth, bottom_time,
+			water_temp, trip_id
+		)
+		values ($1, $2, $3, $4, $5, $6, $7, $8)
+	 returning id, version, created_at, updated_at
+	`
+
+	args := []any{
+		dive.UserID,
+		dive.StartedAt,
+		dive.Site,
+		dive.SiteID,
+		dive.MaxDepth,
+		dive.BottomTime,
+		dive.WaterTemp,
+		dive.TripID,
+	}
+
+	row := tx.QueryRowContext(ctx, query, args...)
+	err = row.Scan(&dive.ID, &dive.Version, &dive.CreatedAt, &dive.UpdatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = setBuddyLinks(ctx, tx, diveBuddiesLink, dive.ID, dive.UserID, dive.BuddyIDs)
+	if err != nil {
+		return err
+	}
+
+	dive.Profile, err = setDiveProfile(ctx, tx, dive.ID, dive.Samples)
+	if err != nil {
+		return err
+	}
+
+	err = setDiveCylinders(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	err = setDiveNumber(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	dive.setSAC()
+
+	return tx.Commit()
+}
+
+// GetOneByID queries the database for the Dive with the given ID. If no
+// matching record exists, ErrRecordNotFound is returned.
+func (m DiveModel) GetOneByID(ctx context.Context, id int64) (*Dive, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select
+		       d.id, d.version, d.created_at, d.updated_at, d.user_id,
+		       dv.dive_number_offset + (
+		           select count(*)
+		             from dives prev
+		            where prev.user_id = d.user_id
+		              and (prev.started_at, prev.id) <= (d.started_at, d.id)
+		       ),
+		       d.started_at, d.site, d.site_id, d.max_depth, d.bottom_time,
+		       d.water_temp, d.trip_id,
+		       array(
+		           select buddy_id
+		             from dive_buddies
+		            where dive_id = d.id
+		         order by buddy_id
+		       ),
+		       p.sample_count, p.duration, p.max_depth, p.avg_depth,
+		       p.max_ascent_rate, p.ascent_violations
+		  from dives d
+		  join divers dv on dv.user_id = d.user_id
+	 left join dive_profiles p on p.dive_id = d.id
+		 where d.id = $1
+	`
+
+	var dive Dive
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var summary profileSummaryColumns
+	dest := []any{
+		&dive.ID,
+		&dive.Version,
+		&dive.CreatedAt,
+		&dive.UpdatedAt,
+		&dive.UserID,
+		&dive.Number,
+		&dive.StartedAt,
+		&dive.Site,
+		&dive.SiteID,
+		&dive.MaxDepth,
+		&dive.BottomTime,
+		&dive.WaterTemp,
+		&dive.TripID,
+		pq.Array(&dive.BuddyIDs),
+	}
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(append(dest, summary.dest()...)...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	dive.Profile = summary.summary()
+
+	err = m.loadCylinders(ctx, []*Dive{&dive})
+	if err != nil {
+		return nil, err
+	}
+
+	return &dive, nil
+}
+
+// GetAllForDiver queries the database for a page of the dives logged by the
+// Diver with the given UserID, sorted and paginated according to the given
+// Filters.
+func (m DiveModel) GetAllForDiver(ctx context.Context, userID string, filters Filters) ([]*Dive, Metadata, error) {
+	// The dives are numbered before they are sorted and paginated, so that
+	// each dive keeps its number whichever page it appears on.
+	query := fmt.Sprintf(`
+		with numbered as (
+			select
+			       d.*,
+			       dv.dive_number_offset + row_number() over (
+			           order by d.started_at, d.id
+			       ) as number
+			  from dives d
+			  join divers dv on dv.user_id = d.user_id
+			 where d.user_id = $1
+		)
+		select
+		       count(*) over(), n.id, n.version, n.created_at, n.updated_at,
+		       n.user_id, n.number, n.started_at, n.site, n.site_id,
+		       n.max_depth, n.bottom_time, n.water_temp, n.trip_id,
+		       array(
+		           select buddy_id
+		             from dive_buddies
+		            where dive_id = n.id
+		         order by buddy_id
+		       ),
+		       p.sample_count, p.duration, p.max_depth, p.avg_depth,
+		       p.max_ascent_rate, p.ascent_violations
+		  from numbered n
+	 left join dive_profiles p on p.dive_id = n.id
+	  order by n.%s %s, n.id asc
+		 limit $2 offset $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{userID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	dives := []*Dive{}
+	for rows.Next() {
+		var dive Dive
+		var summary profileSummaryColumns
+
+		dest := []any{
+			&totalRecords,
+			&dive.ID,
+			&dive.Version,
+			&dive.CreatedAt,
+			&dive.UpdatedAt,
+			&dive.UserID,
+			&dive.Number,
+			&dive.StartedAt,
+			&dive.Site,
+			&dive.SiteID,
+			&dive.MaxDepth,
+			&dive.BottomTime,
+			&dive.WaterTemp,
+			&dive.TripID,
+			pq.Array(&dive.BuddyIDs),
+		}
+
+		err := rows.Scan(append(dest, summary.dest()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		dive.Profile = summary.summary()
+		dives = append(dives, &dive)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	err = m.loadCylinders(ctx, dives)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return dives, metadata, nil
+}
+
+// GetRecentForDiver queries the database for the dives logged by the Diver
+// with the given userID that started at or after since, in the order that they
+// started. Only the fields needed to model the gas that the diver took up are
+// fetched, which are the ID, UserID, StartedAt, MaxDepth, BottomTime and
+// Cylinders.
+func (m DiveModel) GetRecentForDiver(ctx context.Context, userID string, since time.Time) ([]*Dive, error) {
+	query := `
+		select id, user_id, started_at, max_depth, bottom_time
+		  from dives
+		 where user_id = $1
+		   and started_at >= $2
+	  order by started_at, id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dives := []*Dive{}
+	for rows.Next() {
+		var dive Dive
+
+		err := rows.Scan(
+			&dive.ID,
+			&dive.UserID,
+			&dive.StartedAt,
+			&dive.MaxDepth,
+			&dive.BottomTime,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		dives = append(dives, &dive)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.loadCylinders(ctx, dives)
+	if err != nil {
+		return nil, err
+	}
+
+	return dives, nil
+}
+
+// loadCylinders queries the database for the cylinders used on each of the
+// given dives and sets their Cylinders and SAC. This is done with a single
+// query, so that fetching a page of dives does not need a query per dive.
+func (m DiveModel) loadCylinders(ctx context.Context, dives []*Dive) error {
+	if len(dives) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Dive, len(dives))
+	ids := make([]int64, 0, len(dives))
+	for _, dive := range dives {
+		dive.Cylinders = []DiveCylinder{}
+		byID[dive.ID] = dive
+		ids = append(ids, dive.ID)
+	}
+
+	query := `
+		select dive_id, description, size, work_pressure, start_pressure,
+		       end_pressure, o2, he
+		  from dive_cylinders
+		 where dive_id = any($1)
+	  order by dive_id, position
+	`
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var diveID int64
+		var cyl DiveCylinder
+
+		err := rows.Scan(
+			&diveID,
+			&cyl.Description,
+			&cyl.Size,
+			&cyl.WorkPressure,
+			&cyl.StartPressure,
+			&cyl.EndPressure,
+			&cyl.O2,
+			&cyl.He,
+		)
+		if err != nil {
+			return err
+		}
+
+		dive := byID[diveID]
+		dive.Cylinders = append(dive.Cylinders, cyl)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	for _, dive := range dives {
+		dive.setSAC()
+	}
+
+	return nil
+}
+
+// ExistsAt reports whether the Diver with the given userID has already logged
+// a dive that started at the given time.
+func (m DiveModel) ExistsAt(ctx context.Context, userID string, startedAt time.Time) (bool, error) {
+	query := `
+		select exists (
+			select 1
+			  from dives
+			 where user_id = $1
+			   and started_at = $2
+		)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query, userID, startedAt).Scan(&exists)
+
+	return exists, err
+}
+
+// Update updates the details, buddies and cylinders of the given Dive in the
+// database. The update will only succeed if the version in the database still
+// matches that of the given dive, otherwise ErrEditConflict is returned. On
+// success, the dive's Version, Number and SAC fields are updated, as changing
+// when the dive started may change its number.
+func (m DiveModel) Update(ctx context.Context, dive *Dive) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = checkDiveTrip(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		update dives
+		   set started_at = $1, site = $2, site_id = $3, max_depth = $4,
+		       bottom_time = $5, water_temp = $6, trip_id = $7,
+		       version = version + 1, updated_at = now()
+		 where id = $8
+		   and version = $9
+	 returning version, updated_at
+	`
+
+	args := []any{
+		dive.StartedAt,
+		dive.Site,
+		dive.SiteID,
+		dive.MaxDepth,
+		dive.BottomTime,
+		dive.WaterTemp,
+		dive.TripID,
+		dive.ID,
+		dive.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&dive.Version, &dive.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	err = setBuddyLinks(ctx, tx, diveBuddiesLink, dive.ID, dive.UserID, dive.BuddyIDs)
+	if err != nil {
+		return err
+	}
+
+	err = setDiveCylinders(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	err = setDiveNumber(ctx, tx, dive)
+	if err != nil {
+		return err
+	}
+
+	dive.setSAC()
+
+	return tx.Commit()
+}
+
+// Delete removes the Dive with the given ID logged by the Diver with the given
+// userID from the database. If no matching record exists, ErrRecordNotFound is
+// returned. The numbers of any later dives go down by one.
+func (m DiveModel) Delete(ctx context.Context, userID string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from dives
+		 where id = $1
+		   and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
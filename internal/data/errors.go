@@ -0,0 +1,147 @@
+package data
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/m5lapp/go-service-toolkit/persistence/sqldb"
+)
+
+// Postgres error codes for the integrity constraint violations that are
+// translated into typed errors. See
+// https://www.postgresql.org/docs/current/errcodes-appendix.html.
+const (
+	pqNotNullViolation    = pq.ErrorCode("23502")
+	pqForeignKeyViolation = pq.ErrorCode("23503")
+	pqUniqueViolation     = pq.ErrorCode("23505")
+	pqCheckViolation      = pq.ErrorCode("23514")
+)
+
+// constraintColumns maps the names of database constraints to the columns that
+// a violation should be reported against, where these differ from the full set
+// of columns that make up the constraint. This is typically because one of the
+// columns is the owning user's ID, which the client has no control over.
+var constraintColumns = map[string][]string{
+	"agency_courses_agency_id_name_key":    {"name"},
+	"certifications_user_id_course_id_key": {"course_id"},
+	// The buddy_user_id is resolved from the buddy's email address.
+	"buddies_user_id_buddy_user_id_key": {"email"},
+	"buddies_user_id_email_key":         {"email"},
+	"buddies_status_check":              {"status"},
+	"divers_user_id_check":              {"user_id"},
+	"trips_check":                       {"end_date"},
+	"trip_sites_site_id_fkey":           {"site_ids"},
+	"dive_sites_country_name_key":       {"name"},
+}
+
+// detailColumnsRX matches the list of columns in the detail of a unique or
+// foreign key violation, for example: Key (user_id, course_id)=(...) already
+// exists.
+var detailColumnsRX = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// ErrForeignKeyViolation is returned when an insert or update refers to a
+// record that does not exist, or a delete would leave other records referring
+// to one that no longer does.
+type ErrForeignKeyViolation struct {
+	Table      string
+	Constraint string
+	Columns    []string
+}
+
+func (e *ErrForeignKeyViolation) Error() string {
+	return fmt.Sprintf("foreign key constraint %q violated on table %s", e.Constraint, e.Table)
+}
+
+// ErrCheckViolation is returned when a value fails a check constraint.
+type ErrCheckViolation struct {
+	Table      string
+	Constraint string
+	Columns    []string
+}
+
+func (e *ErrCheckViolation) Error() string {
+	return fmt.Sprintf("check constraint %q violated on table %s", e.Constraint, e.Table)
+}
+
+// ErrNotNullViolation is returned when a required column is given a null
+// value.
+type ErrNotNullViolation struct {
+	Table  string
+	Column string
+}
+
+func (e *ErrNotNullViolation) Error() string {
+	return fmt.Sprintf("null value in column %s of table %s", e.Column, e.Table)
+}
+
+// constraintErrColumns works out which columns the given pq.Error relates to,
+// first from the constraintColumns map, then from the detail of the error
+// message and finally from the column reported by Postgres, if any.
+func constraintErrColumns(pqErr *pq.Error) []string {
+	if cols, ok := constraintColumns[pqErr.Constraint]; ok {
+		return cols
+	}
+
+	if m := detailColumnsRX.FindStringSubmatch(pqErr.Detail); m != nil {
+		cols := strings.Split(m[1], ",")
+		for i := range cols {
+			cols[i] = strings.TrimSpace(cols[i])
+		}
+		return cols
+	}
+
+	if pqErr.Column != "" {
+		return []string{pqErr.Column}
+	}
+
+	return nil
+}
+
+// translateError converts integrity constraint violations returned by Postgres
+// into typed errors that describe the offending table and columns. Unique
+// violations become an sqldb.ErrUniqueConstraintViolation. Any other error is
+// returned as is.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case pqUniqueViolation:
+		return sqldb.NewUniqueConstraintErr(pqErr.Table, constraintErrColumns(pqErr)...)
+	case pqForeignKeyViolation:
+		return &ErrForeignKeyViolation{
+			Table:      pqErr.Table,
+			Constraint: pqErr.Constraint,
+			Columns:    constraintErrColumns(pqErr),
+		}
+	case pqCheckViolation:
+		return &ErrCheckViolation{
+			Table:      pqErr.Table,
+			Constraint: pqErr.Constraint,
+			Columns:    constraintErrColumns(pqErr),
+		}
+	case pqNotNullViolation:
+		return &ErrNotNullViolation{Table: pqErr.Table, Column: pqErr.Column}
+	default:
+		return err
+	}
+}
+
+// translateDeleteError behaves like translateError, but also converts foreign
+// key violations into ErrRecordInUse, as they can only mean that other records
+// still refer to the one being deleted.
+func translateDeleteError(err error) error {
+	err = translateError(err)
+
+	var fkErr *ErrForeignKeyViolation
+	if errors.As(err, &fkErr) {
+		return ErrRecordInUse
+	}
+
+	return err
+}
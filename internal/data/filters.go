@@ -0,0 +1,86 @@
+package data
+
+import (
+	"math"
+	"strings"
+
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// Filters holds the pagination and sorting parameters for a list endpoint. The
+// Sort field is the name of a column to sort by, prefixed with a "-" to sort in
+// descending order, and must be one of the values in SortSafelist.
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+}
+
+// ValidateFilters validates a Filters struct and stores any errors in the
+// provided validator.Validator struct.
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "Must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "Must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "Must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "Must be a maximum of 100")
+
+	v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort",
+		"Must be one of "+strings.Join(f.SortSafelist, ", "))
+}
+
+// sortColumn returns the column to sort by. It panics if the Sort field is not
+// in the safelist, as a last line of defence against SQL injection, since the
+// column name is interpolated into the query.
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// sortDirection returns the SQL sort direction for the Sort field.
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "desc"
+	}
+
+	return "asc"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata describes the page of results returned by a list endpoint.
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata works out the pagination Metadata from the total number of
+// records matching the query. If there are no records, empty Metadata is
+// returned.
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
@@ -0,0 +1,205 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"time"
+
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// Invitation represents a single-use invitation for a buddy who is not yet a
+// registered diver. When the invitation is redeemed, the buddy record it was
+// created for is linked to the new diver's account.
+type Invitation struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	BuddyID   int64     `json:"buddy_id"`
+	UserID    string    `json:"-"`
+	Email     string    `json:"email"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type InvitationModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+// generateInvitation creates a new Invitation for the given buddy with a random
+// plaintext token that expires after the given ttl. Only the SHA-256 hash of
+// the token is ever stored in the database.
+func generateInvitation(buddy *Buddy, ttl time.Duration) (*Invitation, error) {
+	randomBytes := make([]byte, 16)
+
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Invitation{
+		Plaintext: base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes),
+		BuddyID:   buddy.ID,
+		UserID:    buddy.UserID,
+		Email:     *buddy.Email,
+		Expiry:    time.Now().Add(ttl),
+	}
+
+	hash := sha256.Sum256([]byte(inv.Plaintext))
+	inv.Hash = hash[:]
+
+	return inv, nil
+}
+
+// ValidateInvitationToken checks that the given plaintext invitation token is
+// in the expected format and stores any errors in the provided
+// validator.Validator struct.
+func ValidateInvitationToken(v *validator.Validator, key, plaintext string) {
+	v.Check(plaintext != "", key, "Must be provided")
+	v.Check(len(plaintext) == 26, key, "Must be 26 bytes long")
+}
+
+// insertInvitation creates a new Invitation for the given Buddy, which must
+// have an email address, and stores it in the database as part of the given
+// transaction. The returned Invitation contains the plaintext token to pass on
+// to the buddy.
+func insertInvitation(ctx context.Context, tx *sql.Tx, buddy *Buddy, ttl time.Duration) (*Invitation, error) {
+	inv, err := generateInvitation(buddy, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		insert into buddy_invitations (hash, buddy_id, user_id, email, expiry)
+		values ($1, $2, $3, $4, $5)
+	`
+
+	args := []any{inv.Hash, inv.BuddyID, inv.UserID, inv.Email, inv.Expiry}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return inv, nil
+}
+
+// GetByToken queries the database for the unexpired Invitation matching the
+// given plaintext token. If no matching record exists, ErrRecordNotFound is
+// returned.
+func (m InvitationModel) GetByToken(ctx context.Context, plaintext string) (*Invitation, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+		select hash, buddy_id, user_id, email, expiry
+		  from buddy_invitations
+		 where hash = $1
+		   and expiry > now()
+	`
+
+	inv := Invitation{Plaintext: plaintext}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:]).Scan(
+		&inv.Hash,
+		&inv.BuddyID,
+		&inv.UserID,
+		&inv.Email,
+		&inv.Expiry,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &inv, nil
+}
+
+// Redeem uses up the given Invitation by linking the buddy record it was
+// created for to the Diver with the given userID and name, and inserting the
+// reciprocal Buddy record for the new diver, making the two divers accepted
+// buddies of each other. All invitations for the buddy are then deleted so they
+// cannot be used again. If the buddy no longer exists, has already been linked
+// or its email address has changed since the invitation was created,
+// ErrRecordNotFound is returned. All changes are made in a single transaction.
+func (m InvitationModel) Redeem(ctx context.Context, inv *Invitation, userID, name string, reciprocal *Buddy) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update buddies
+		   set buddy_user_id = $1, name = $2, status = 'accepted',
+		       version = version + 1, updated_at = now()
+		 where id = $3
+		   and email = $4
+		   and buddy_user_id is null
+	`
+
+	result, err := tx.ExecContext(ctx, query, userID, name, inv.BuddyID, inv.Email)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	query = `
+		insert into buddies (
+			user_id, buddy_user_id, name, email, status
+		)
+		values ($1, $2, $3, $4, $5)
+	 returning id, version, created_at, updated_at
+	`
+
+	args := []any{
+		reciprocal.UserID,
+		reciprocal.BuddyUserID,
+		reciprocal.Name,
+		reciprocal.Email,
+		reciprocal.Status,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&reciprocal.ID,
+		&reciprocal.Version,
+		&reciprocal.CreatedAt,
+		&reciprocal.UpdatedAt,
+	)
+	if err != nil {
+		return translateError(err)
+	}
+
+	query = `
+		delete from buddy_invitations
+		 where buddy_id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, inv.BuddyID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -3,23 +3,45 @@ package data
 import (
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
 	ErrEditConflict   = errors.New("edit conflict")
+	ErrRecordInUse    = errors.New("record in use")
 	ErrRecordNotFound = errors.New("record not found")
 )
 
+// Timeouts holds the maximum time that database operations are allowed to take
+// before they are cancelled. Read timeouts apply to queries that only select
+// data and Write timeouts apply to everything else, including transactions.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+}
+
 type Models struct {
-	Agencies AgencyModel
-	Buddies  BuddyModel
-	Divers   DiverModel
+	Agencies       AgencyModel
+	AgencyCourses  AgencyCourseModel
+	Buddies        BuddyModel
+	Certifications CertificationModel
+	Dives          DiveModel
+	DiveSites      DiveSiteModel
+	Divers         DiverModel
+	Invitations    InvitationModel
+	Trips          TripModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, timeouts Timeouts) Models {
 	return Models{
-		Agencies: AgencyModel{DB: db},
-		Buddies:  BuddyModel{DB: db},
-		Divers:   DiverModel{DB: db},
+		Agencies:       AgencyModel{DB: db, Timeouts: timeouts},
+		AgencyCourses:  AgencyCourseModel{DB: db, Timeouts: timeouts},
+		Buddies:        BuddyModel{DB: db, Timeouts: timeouts},
+		Certifications: CertificationModel{DB: db, Timeouts: timeouts},
+		Dives:          DiveModel{DB: db, Timeouts: timeouts},
+		DiveSites:      DiveSiteModel{DB: db, Timeouts: timeouts},
+		Divers:         DiverModel{DB: db, Timeouts: timeouts},
+		Invitations:    InvitationModel{DB: db, Timeouts: timeouts},
+		Trips:          TripModel{DB: db, Timeouts: timeouts},
 	}
 }
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"math"
+)
+
+// SACRecentDives is the number of a diver's most recent dives that their
+// rolling average SAC rate is worked out over.
+const SACRecentDives = 10
+
+// LitresPerCubicFoot converts volumes of gas between metric and imperial
+// units.
+const LitresPerCubicFoot = 28.316846592
+
+// SACRate is a surface air consumption rate: the volume of gas that a diver
+// breathed per minute, adjusted to the surface pressure so that rates from
+// dives to different depths can be compared. It is given in both litres and
+// cubic feet per minute.
+type SACRate struct {
+	LitresPerMinute    float64 `json:"litres_per_minute"`
+	CubicFeetPerMinute float64 `json:"cubic_feet_per_minute"`
+}
+
+// NewSACRate returns a SACRate for the given rate in litres per minute,
+// rounded to a sensible precision in each unit.
+func NewSACRate(litresPerMinute float64) *SACRate {
+	return &SACRate{
+		LitresPerMinute:    math.Round(litresPerMinute*10) / 10,
+		CubicFeetPerMinute: math.Round(litresPerMinute/LitresPerCubicFoot*100) / 100,
+	}
+}
+
+// DiverSAC is a Diver's rolling average SAC rate over the given number of
+// their most recent dives with enough cylinder details to work it out.
+type DiverSAC struct {
+	SACRate
+	Dives int `json:"dives"`
+}
+
+// setSAC works out the SAC rate of the Dive from the gas used from each of its
+// Cylinders that has a size, start pressure and end pressure. The average
+// depth and duration are taken from the dive's profile if it has one.
+// Otherwise, the maximum depth and bottom time are used, which gives a lower
+// rate than the diver really breathed at. If no gas use was recorded, the SAC
+// is set to nil.
+//
+// The calculation must match the one in DiveModel.GetAverageSAC.
+func (dive *Dive) setSAC() {
+	dive.SAC = nil
+
+	var used float64
+	for _, cyl := range dive.Cylinders {
+		if cyl.Size == nil || cyl.StartPressure == nil || cyl.EndPressure == nil {
+			continue
+		}
+		used += *cyl.Size * (*cyl.StartPressure - *cyl.EndPressure)
+	}
+
+	minutes, depth := float64(dive.BottomTime), dive.MaxDepth
+	if dive.Profile != nil && dive.Profile.Duration > 0 {
+		minutes, depth = float64(dive.Profile.Duration)/60, dive.Profile.AvgDepth
+	}
+
+	if used <= 0 || minutes <= 0 {
+		return
+	}
+
+	// The ambient pressure in bar rises by one for every ten metres of depth.
+	dive.SAC = NewSACRate(used / minutes / (1 + depth/10))
+}
+
+// GetAverageSAC queries the database for the rolling average SAC rate of the
+// Diver with the given userID over their SACRecentDives most recent dives that
+// have one. If none of their dives have a SAC rate, nil is returned.
+func (m DiveModel) GetAverageSAC(ctx context.Context, userID string) (*DiverSAC, error) {
+	query := `
+		with recent as (
+			select
+			       sum(c.size * (c.start_pressure - c.end_pressure)) as used,
+			       case when p.duration > 0 then p.duration / 60.0
+			            else d.bottom_time end as minutes,
+			       case when p.duration > 0 then p.avg_depth
+			            else d.max_depth end as depth
+			  from dives d
+			  join dive_cylinders c on c.dive_id = d.id
+		 left join dive_profiles p on p.dive_id = d.id
+			 where d.user_id = $1
+			   and c.size is not null
+			   and c.start_pressure is not null
+			   and c.end_pressure is not null
+		  group by d.id, p.duration, p.avg_depth
+			having sum(c.size * (c.start_pressure - c.end_pressure)) > 0
+		  order by d.started_at desc
+			 limit $2
+		)
+		select count(*), avg(used / minutes / (1 + depth / 10))
+		  from recent
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	var dives int
+	var avg sql.NullFloat64
+
+	err := m.DB.QueryRowContext(ctx, query, userID, SACRecentDives).Scan(&dives, &avg)
+	if err != nil {
+		return nil, err
+	}
+
+	if !avg.Valid {
+		return nil, nil
+	}
+
+	return &DiverSAC{SACRate: *NewSACRate(avg.Float64), Dives: dives}, nil
+}
@@ -0,0 +1,413 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"github.com/m5lapp/go-service-toolkit/validator"
+)
+
+// The values that the list of a Diver's trips can be filtered by. Past trips
+// are those that ended before today, upcoming trips are those that have not
+// yet ended, which includes any that are in progress.
+const (
+	TripsAll      = "all"
+	TripsPast     = "past"
+	TripsUpcoming = "upcoming"
+)
+
+// Trip represents a diving trip that a Diver has been on or is planning. The
+// participants are buddies from the diver's buddy list, the sites are those
+// from the dive site catalogue that the trip visits and the dives are those
+// from their log book that have been attached to the trip. The DiveIDs are
+// read-only, dives are attached to a trip by setting their TripID.
+type Trip struct {
+	ID             int64          `json:"id"`
+	Version        int            `json:"version"`
+	CreatedAt      time.Time      `json:"-"`
+	UpdatedAt      time.Time      `json:"-"`
+	UserID         string         `json:"user_id"`
+	Name           string         `json:"name"`
+	StartDate      jsonz.DateOnly `json:"start_date"`
+	EndDate        jsonz.DateOnly `json:"end_date"`
+	Country        *string        `json:"country,omitempty"`
+	TimeZone       *string        `json:"time_zone,omitempty"`
+	Itinerary      *string        `json:"itinerary,omitempty"`
+	ParticipantIDs []int64        `json:"participant_ids"`
+	SiteIDs        []int64        `json:"site_ids"`
+	DiveIDs        []int64        `json:"dive_ids"`
+}
+
+type TripModel struct {
+	DB       *sql.DB
+	Timeouts Timeouts
+}
+
+var tripParticipantsLink = buddyLink{table: "trip_participants", column: "trip_id", field: "participant_ids"}
+
+// ValidateTrip validates a Trip struct and stores any errors in the provided
+// validator.Validator struct. Checking that the participants are the diver's
+// buddies requires a database lookup, so is done when the trip is saved.
+func ValidateTrip(v *validator.Validator, trip *Trip) {
+	validator.ValidateStrLenRune(v, trip.Name, "name", 2, 256)
+
+	v.Check(!trip.StartDate.IsZero(), "start_date", "Must be provided")
+	v.Check(!trip.EndDate.IsZero(), "end_date", "Must be provided")
+	v.Check(!trip.EndDate.Before(trip.StartDate.Time), "end_date", "Must not be before the start date")
+
+	if trip.Country != nil {
+		// TODO: Ensure the country code is a valid option.
+		v.Check(len(*trip.Country) == 2, "country", "Must be exactly two bytes long")
+	}
+
+	if trip.TimeZone != nil {
+		_, err := time.LoadLocation(*trip.TimeZone)
+		v.Check(err == nil, "time_zone", "Must be a valid time zone name")
+	}
+
+	if trip.Itinerary != nil {
+		validator.ValidateStrLenRune(v, *trip.Itinerary, "itinerary", 1, 8192)
+	}
+
+	v.Check(len(trip.ParticipantIDs) <= 50, "participant_ids", "Must contain a maximum of 50 participants")
+	v.Check(validator.Unique(trip.ParticipantIDs), "participant_ids", "Must not contain duplicate participants")
+	for _, id := range trip.ParticipantIDs {
+		v.Check(id > 0, "participant_ids", "Must only contain valid buddy IDs")
+	}
+
+	v.Check(len(trip.SiteIDs) <= 100, "site_ids", "Must contain a maximum of 100 dive sites")
+	v.Check(validator.Unique(trip.SiteIDs), "site_ids", "Must not contain duplicate dive sites")
+	for _, id := range trip.SiteIDs {
+		v.Check(id > 0, "site_ids", "Must only contain valid dive site IDs")
+	}
+}
+
+// setTripSites replaces the dive sites that the given Trip visits with those
+// in its SiteIDs. If any of the sites do not exist, an ErrForeignKeyViolation
+// is returned.
+func setTripSites(ctx context.Context, tx *sql.Tx, trip *Trip) error {
+	query := `
+		delete from trip_sites
+		 where trip_id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, trip.ID)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		insert into trip_sites (trip_id, site_id)
+		select $1, unnest($2::bigint[])
+	`
+
+	_, err = tx.ExecContext(ctx, query, trip.ID, pq.Array(trip.SiteIDs))
+	if err != nil {
+		return translateError(err)
+	}
+
+	return nil
+}
+
+// Insert adds the given Trip, its participants and sites into the database. If
+// any of the participants are not the diver's buddies or any of the sites do
+// not exist, an ErrForeignKeyViolation is returned and nothing is saved.
+func (m TripModel) Insert(ctx context.Context, trip *Trip) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		insert into trips (
+			user_id, name, start_date, end_date, country, time_zone, itinerary
+		)
+		values ($1, $2, $3, $4, $5, $6, $7)
+	 returning id, version, created_at, updated_at
+	`
+
+	args := []any{
+		trip.UserID,
+		trip.Name,
+		trip.StartDate,
+		trip.EndDate,
+		trip.Country,
+		trip.TimeZone,
+		trip.Itinerary,
+	}
+
+	row := tx.QueryRowContext(ctx, query, args...)
+	err = row.Scan(&trip.ID, &trip.Version, &trip.CreatedAt, &trip.UpdatedAt)
+	if err != nil {
+		return translateError(err)
+	}
+
+	err = setBuddyLinks(ctx, tx, tripParticipantsLink, trip.ID, trip.UserID, trip.ParticipantIDs)
+	if err != nil {
+		return err
+	}
+
+	err = setTripSites(ctx, tx, trip)
+	if err != nil {
+		return err
+	}
+
+	// A new trip cannot have any dives attached to it yet.
+	trip.DiveIDs = []int64{}
+
+	return tx.Commit()
+}
+
+// GetOneByID queries the database for the Trip with the given ID. If no
+// matching record exists, ErrRecordNotFound is returned.
+func (m TripModel) GetOneByID(ctx context.Context, id int64) (*Trip, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		select
+		       t.id, t.version, t.created_at, t.updated_at, t.user_id, t.name,
+		       t.start_date, t.end_date, t.country, t.time_zone, t.itinerary,
+		       array(
+		           select buddy_id
+		             from trip_participants
+		            where trip_id = t.id
+		         order by buddy_id
+		       ),
+		       array(
+		           select site_id
+		             from trip_sites
+		            where trip_id = t.id
+		         order by site_id
+		       ),
+		       array(
+		           select id
+		             from dives
+		            where trip_id = t.id
+		         order by started_at, id
+		       )
+		  from trips t
+		 where t.id = $1
+	`
+
+	var trip Trip
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&trip.ID,
+		&trip.Version,
+		&trip.CreatedAt,
+		&trip.UpdatedAt,
+		&trip.UserID,
+		&trip.Name,
+		&trip.StartDate,
+		&trip.EndDate,
+		&trip.Country,
+		&trip.TimeZone,
+		&trip.Itinerary,
+		pq.Array(&trip.ParticipantIDs),
+		pq.Array(&trip.SiteIDs),
+		pq.Array(&trip.DiveIDs),
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &trip, nil
+}
+
+// GetAllForDiver queries the database for a page of the trips of the Diver with
+// the given UserID, sorted and paginated according to the given Filters. The
+// when parameter must be one of TripsAll, TripsPast or TripsUpcoming.
+func (m TripModel) GetAllForDiver(ctx context.Context, userID, when string, filters Filters) ([]*Trip, Metadata, error) {
+	query := fmt.Sprintf(`
+		select
+		       count(*) over(), t.id, t.version, t.created_at, t.updated_at,
+		       t.user_id, t.name, t.start_date, t.end_date, t.country,
+		       t.time_zone, t.itinerary,
+		       array(
+		           select buddy_id
+		             from trip_participants
+		            where trip_id = t.id
+		         order by buddy_id
+		       ),
+		       array(
+		           select site_id
+		             from trip_sites
+		            where trip_id = t.id
+		         order by site_id
+		       ),
+		       array(
+		           select id
+		             from dives
+		            where trip_id = t.id
+		         order by started_at, id
+		       )
+		  from trips t
+		 where t.user_id = $1
+		   and ($2 = 'all'
+		        or ($2 = 'past' and t.end_date < current_date)
+		        or ($2 = 'upcoming' and t.end_date >= current_date))
+	  order by %s %s, t.id asc
+		 limit $3 offset $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{userID, when, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Read)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	trips := []*Trip{}
+	for rows.Next() {
+		var trip Trip
+
+		err := rows.Scan(
+			&totalRecords,
+			&trip.ID,
+			&trip.Version,
+			&trip.CreatedAt,
+			&trip.UpdatedAt,
+			&trip.UserID,
+			&trip.Name,
+			&trip.StartDate,
+			&trip.EndDate,
+			&trip.Country,
+			&trip.TimeZone,
+			&trip.Itinerary,
+			pq.Array(&trip.ParticipantIDs),
+			pq.Array(&trip.SiteIDs),
+			pq.Array(&trip.DiveIDs),
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		trips = append(trips, &trip)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return trips, metadata, nil
+}
+
+// Update updates the details, participants and sites of the given Trip in the
+// database. The update will only succeed if the version in the database still
+// matches that of the given trip, otherwise ErrEditConflict is returned.
+func (m TripModel) Update(ctx context.Context, trip *Trip) error {
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		update trips
+		   set name = $1, start_date = $2, end_date = $3, country = $4,
+		       time_zone = $5, itinerary = $6, version = version + 1,
+		       updated_at = now()
+		 where id = $7
+		   and version = $8
+	 returning version, updated_at
+	`
+
+	args := []any{
+		trip.Name,
+		trip.StartDate,
+		trip.EndDate,
+		trip.Country,
+		trip.TimeZone,
+		trip.Itinerary,
+		trip.ID,
+		trip.Version,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&trip.Version, &trip.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	err = setBuddyLinks(ctx, tx, tripParticipantsLink, trip.ID, trip.UserID, trip.ParticipantIDs)
+	if err != nil {
+		return err
+	}
+
+	err = setTripSites(ctx, tx, trip)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the Trip with the given ID belonging to the Diver with the
+// given userID from the database. If no matching record exists,
+// ErrRecordNotFound is returned. Any dives attached to the trip are kept, but
+// are no longer attached to any trip.
+func (m TripModel) Delete(ctx context.Context, userID string, id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		delete from trips
+		 where id = $1
+		   and user_id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, m.Timeouts.Write)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
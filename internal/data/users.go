@@ -12,6 +12,7 @@ type User struct {
 	Gender       *string         `json:"gender,omitempty"`
 	CountryCode  *string         `json:"country_code,omitempty"`
 	TimeZone     *string         `json:"time_zone,omitempty"`
+	Roles        []string        `json:"roles,omitempty"`
 }
 
 // UserResponse represents how a User struct is enveloped from the User service.
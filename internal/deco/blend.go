@@ -0,0 +1,101 @@
+package deco
+
+import (
+	"errors"
+	"math"
+)
+
+// The kinds of BlendStep.
+const (
+	BlendDrain  = "drain"
+	BlendHelium = "add_helium"
+	BlendOxygen = "add_oxygen"
+	BlendTopUp  = "top_up"
+)
+
+// minBlendStep is the smallest change of pressure in bar that is worth making
+// as a step of a blend.
+const minBlendStep = 0.05
+
+// ErrCannotBlend is returned by Blend if the target mix cannot be made from
+// the current fill with the given top-up gas, even after draining the
+// cylinder.
+var ErrCannotBlend = errors.New("deco: the target mix cannot be blended with the given gases")
+
+// Fill is the gas in a cylinder and the pressure that it is at in bar.
+type Fill struct {
+	Pressure float64
+	Gas      Gas
+}
+
+// BlendStep is a single step of a blend. Change is the change of pressure in
+// bar, which is negative for draining, and Pressure is the pressure of the
+// cylinder after the step. Gas is the gas added, and is not set for draining.
+type BlendStep struct {
+	Kind     string
+	Gas      Gas
+	Change   float64
+	Pressure float64
+}
+
+// Blend works out the steps to make the target fill by partial pressure
+// blending, starting from the current fill. Pure helium is added first, then
+// pure oxygen, and then the cylinder is topped up with the topUp gas, which
+// must contain some nitrogen. If the current fill has too much of any gas, the
+// cylinder is first drained by as little as needed. The gases are treated as
+// ideal, so a blender should analyse the result and adjust it.
+func Blend(current, target Fill, topUp Gas) ([]BlendStep, error) {
+	if topUp.N2() <= 0 {
+		return nil, ErrCannotBlend
+	}
+
+	// The nitrogen in the target comes from what is left of the current fill
+	// and the top-up gas, which fixes how much of the top-up gas is added.
+	// Everything added is then a linear function a + b*p of the pressure p
+	// that is left after draining, which must be found so that nothing is
+	// added in a negative amount.
+	pN2 := target.Pressure * target.Gas.N2()
+	topUpA, topUpB := pN2/topUp.N2(), -current.Gas.N2()/topUp.N2()
+
+	heA := target.Pressure*target.Gas.He - topUp.He*topUpA
+	heB := -current.Gas.He - topUp.He*topUpB
+
+	o2A := target.Pressure*target.Gas.O2 - topUp.O2*topUpA
+	o2B := -current.Gas.O2 - topUp.O2*topUpB
+
+	lower, upper := 0.0, current.Pressure
+	for _, c := range [][2]float64{{topUpA, topUpB}, {heA, heB}, {o2A, o2B}} {
+		a, b := c[0], c[1]
+		switch {
+		case b < 0:
+			upper = math.Min(upper, -a/b)
+		case b > 0:
+			lower = math.Max(lower, -a/b)
+		case a < -1e-9:
+			return nil, ErrCannotBlend
+		}
+	}
+
+	if lower > upper+1e-9 {
+		return nil, ErrCannotBlend
+	}
+
+	left := upper
+	pressure := current.Pressure
+	steps := []BlendStep{}
+
+	add := func(kind string, gas Gas, change float64) {
+		if math.Abs(change) < minBlendStep {
+			return
+		}
+		pressure += change
+		steps = append(steps, BlendStep{Kind: kind, Gas: gas, Change: change, Pressure: pressure})
+	}
+
+	add(BlendDrain, Gas{}, left-current.Pressure)
+	add(BlendHelium, Gas{He: 1}, heA+heB*left)
+	add(BlendOxygen, Gas{O2: 1}, o2A+o2B*left)
+	add(BlendTopUp, topUp, topUpA+topUpB*left)
+
+	return steps, nil
+}
@@ -0,0 +1,56 @@
+package deco
+
+const (
+	// CabinPressure is the lowest pressure in bar that an airliner's cabin is
+	// kept at, which is the pressure at an altitude of 8,000 feet.
+	CabinPressure = 0.753
+	// desaturatedExcess is the pressure in bar of inert gas above that of a
+	// diver saturated with air at the surface that each compartment may hold
+	// for the diver to be taken to be desaturated.
+	desaturatedExcess = 0.05
+	// maxSurfaceMinutes is the longest time that is modelled at the surface,
+	// which is long enough for even the slowest compartment to desaturate
+	// after any dive.
+	maxSurfaceMinutes = 7 * 24 * 60
+)
+
+// desaturated reports whether every compartment holds no more than
+// desaturatedExcess bar of inert gas above its pressure at the surface.
+func (t *Tissues) desaturated() bool {
+	surface := (SurfacePressure - waterVapourPressure) * airN2
+
+	for i := range t.n2 {
+		if t.n2[i]+t.he[i]-surface > desaturatedExcess {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DesaturationTime returns the number of whole minutes that a diver with these
+// tissues needs to spend breathing air at the surface until they are
+// desaturated, meaning that they hold almost no more inert gas than they did
+// before diving.
+func (t Tissues) DesaturationTime() int {
+	return t.surfaceUntil(func(t *Tissues) bool { return t.desaturated() })
+}
+
+// NoFlyTime returns the number of whole minutes that a diver with these
+// tissues needs to spend breathing air at the surface until the pressure of
+// inert gas in each compartment would stay within the given fraction of its
+// M-value at CabinPressure.
+func (t Tissues) NoFlyTime(gf float64) int {
+	return t.surfaceUntil(func(t *Tissues) bool { return t.tolerated(gf) <= CabinPressure })
+}
+
+// surfaceUntil returns the number of whole minutes spent breathing air at the
+// surface until done reports true for the tissues, up to maxSurfaceMinutes.
+func (t Tissues) surfaceUntil(done func(*Tissues) bool) int {
+	minutes := 0
+	for ; minutes < maxSurfaceMinutes && !done(&t); minutes++ {
+		t.Expose(0, 0, 1, Air)
+	}
+
+	return minutes
+}
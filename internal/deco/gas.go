@@ -0,0 +1,164 @@
+package deco
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Air is the gas that most dives are made on.
+var Air = Gas{O2: 0.21}
+
+// Gas is a breathing gas made of oxygen, helium and nitrogen. The O2 and He
+// fields are the fractions of oxygen and helium, and the rest is nitrogen.
+type Gas struct {
+	O2 float64
+	He float64
+}
+
+// N2 returns the fraction of nitrogen in the gas.
+func (g Gas) N2() float64 {
+	return math.Max(0, 1-g.O2-g.He)
+}
+
+// PPO2 returns the partial pressure of oxygen in bar when breathing the gas at
+// the given depth.
+func (g Gas) PPO2(depth float64) float64 {
+	return g.O2 * AmbientPressure(depth)
+}
+
+// MOD returns the maximum operating depth of the gas, which is the depth at
+// which its partial pressure of oxygen reaches the given limit in bar.
+func (g Gas) MOD(maxPPO2 float64) float64 {
+	return math.Max(0, depthAt(maxPPO2/g.O2))
+}
+
+// EAD returns the equivalent air depth of the gas at the given depth, which is
+// the depth at which air has the same partial pressure of nitrogen. It is
+// never less than zero.
+func (g Gas) EAD(depth float64) float64 {
+	return math.Max(0, depthAt(AmbientPressure(depth)*g.N2()/airN2))
+}
+
+// END returns the equivalent narcotic depth of the gas at the given depth,
+// which is the depth at which air is as narcotic. If o2Narcotic is true,
+// oxygen is taken to be as narcotic as nitrogen, otherwise only nitrogen is
+// taken to be narcotic. It is never less than zero.
+func (g Gas) END(depth float64, o2Narcotic bool) float64 {
+	narcotic := g.N2() / airN2
+	if o2Narcotic {
+		narcotic = 1 - g.He
+	}
+
+	return math.Max(0, depthAt(AmbientPressure(depth)*narcotic))
+}
+
+// ErrNoMix is returned by BestMix if no gas meets all of the limits.
+var ErrNoMix = errors.New("deco: no gas meets the given limits")
+
+// BestMix returns the gas with the most oxygen, in whole percent, whose partial
+// pressure of oxygen at the given depth is no more than maxPPO2. If maxEND is
+// not nil, just enough helium, in whole percent, is added for the equivalent
+// narcotic depth to be no more than maxEND.
+func BestMix(depth, maxPPO2 float64, maxEND *float64, o2Narcotic bool) (Gas, error) {
+	ambient := AmbientPressure(depth)
+
+	// The small adjustments stop fractions that are exactly a whole percent
+	// from being rounded the wrong way.
+	o2 := math.Floor(math.Min(1, maxPPO2/ambient)*100+1e-9) / 100
+
+	var he float64
+	if maxEND != nil {
+		limit := AmbientPressure(*maxEND) / ambient
+		if o2Narcotic {
+			he = 1 - limit
+		} else {
+			he = 1 - o2 - airN2*limit
+		}
+		he = math.Ceil(math.Max(0, he)*100-1e-9) / 100
+	}
+
+	if o2+he > 1+1e-9 {
+		return Gas{}, ErrNoMix
+	}
+
+	return Gas{O2: o2, He: he}, nil
+}
+
+// String returns the usual name of the gas, such as "Air", "EAN32" or
+// "Trimix 18/45".
+func (g Gas) String() string {
+	o2 := int(math.Round(g.O2 * 100))
+	he := int(math.Round(g.He * 100))
+
+	switch {
+	case he == 0 && o2 == 21:
+		return "Air"
+	case he == 0 && o2 == 100:
+		return "Oxygen"
+	case he == 0:
+		return fmt.Sprintf("EAN%d", o2)
+	case o2+he == 100:
+		return fmt.Sprintf("Heliox %d/%d", o2, he)
+	default:
+		return fmt.Sprintf("Trimix %d/%d", o2, he)
+	}
+}
+
+// cnsLimits holds the NOAA limits on a single exposure to each partial
+// pressure of oxygen, in minutes.
+var cnsLimits = []struct {
+	ppo2    float64
+	minutes float64
+}{
+	{0.6, 720},
+	{0.7, 570},
+	{0.8, 450},
+	{0.9, 360},
+	{1.0, 300},
+	{1.1, 240},
+	{1.2, 210},
+	{1.3, 180},
+	{1.4, 150},
+	{1.5, 120},
+	{1.6, 45},
+}
+
+// cnsPerMinute returns the percentage of the central nervous system oxygen
+// toxicity limit used by each minute breathing oxygen at the given partial
+// pressure. Limits between those in the NOAA table are interpolated. Partial
+// pressures above 1.6 bar are outside the table and are treated as 1.6 bar,
+// which underestimates the risk, so they should not be planned.
+func cnsPerMinute(ppo2 float64) float64 {
+	if ppo2 <= 0.5 {
+		return 0
+	}
+
+	first, last := cnsLimits[0], cnsLimits[len(cnsLimits)-1]
+	switch {
+	case ppo2 <= first.ppo2:
+		return 100 / first.minutes
+	case ppo2 >= last.ppo2:
+		return 100 / last.minutes
+	}
+
+	for i := 1; i < len(cnsLimits); i++ {
+		lo, hi := cnsLimits[i-1], cnsLimits[i]
+		if ppo2 <= hi.ppo2 {
+			limit := lo.minutes + (hi.minutes-lo.minutes)*(ppo2-lo.ppo2)/(hi.ppo2-lo.ppo2)
+			return 100 / limit
+		}
+	}
+
+	return 100 / last.minutes
+}
+
+// otuPerMinute returns the oxygen tolerance units accrued by each minute
+// breathing oxygen at the given partial pressure.
+func otuPerMinute(ppo2 float64) float64 {
+	if ppo2 <= 0.5 {
+		return 0
+	}
+
+	return math.Pow((ppo2-0.5)/0.5, 0.83)
+}
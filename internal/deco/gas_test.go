@@ -0,0 +1,86 @@
+package deco
+
+import (
+	"math"
+	"testing"
+)
+
+// TestCNSPerMinute checks the rates against the single exposure limits for
+// each partial pressure of oxygen in the NOAA Diving Manual, 4th edition,
+// 2001, and the rates between and beyond them.
+func TestCNSPerMinute(t *testing.T) {
+	tests := []struct {
+		ppo2 float64
+		want float64
+	}{
+		{0.21, 0},
+		{0.5, 0},
+		{0.55, 100.0 / 720},
+		{0.6, 100.0 / 720},
+		{0.7, 100.0 / 570},
+		{0.8, 100.0 / 450},
+		{0.9, 100.0 / 360},
+		{1.0, 100.0 / 300},
+		{1.1, 100.0 / 240},
+		{1.2, 100.0 / 210},
+		{1.3, 100.0 / 180},
+		{1.4, 100.0 / 150},
+		{1.45, 100.0 / 135},
+		{1.5, 100.0 / 120},
+		{1.6, 100.0 / 45},
+		{1.7, 100.0 / 45},
+	}
+
+	for _, tt := range tests {
+		got := cnsPerMinute(tt.ppo2)
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("cnsPerMinute(%.2f) = %.6f, want %.6f", tt.ppo2, got, tt.want)
+		}
+	}
+}
+
+func TestOTUPerMinute(t *testing.T) {
+	tests := []struct {
+		ppo2 float64
+		want float64
+	}{
+		{0.21, 0},
+		{0.5, 0},
+		{1.0, 1},
+		{1.4, 1.628832},
+		{1.6, 1.924026},
+	}
+
+	for _, tt := range tests {
+		got := otuPerMinute(tt.ppo2)
+		if math.Abs(got-tt.want) > 1e-6 {
+			t.Errorf("otuPerMinute(%.2f) = %.6f, want %.6f", tt.ppo2, got, tt.want)
+		}
+	}
+}
+
+func TestGasLimits(t *testing.T) {
+	ean32 := Gas{O2: 0.32}
+	tx2135 := Gas{O2: 0.21, He: 0.35}
+
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"EAN32 MOD at 1.4", ean32.MOD(1.4), 33.6175},
+		{"oxygen MOD at 1.6", Gas{O2: 1}.MOD(1.6), 5.8675},
+		{"EAN32 EAD at 30 m", ean32.EAD(30), 24.4032},
+		{"EAN32 EAD at the surface", ean32.EAD(0), 0},
+		{"trimix 21/35 END at 50 m", tx2135.END(50, true), 28.9536},
+		{"trimix 21/35 END at 50 m with O2 not narcotic", tx2135.END(50, false), 23.3505},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if math.Abs(tt.got-tt.want) > 1e-3 {
+				t.Errorf("got %.4f, want %.4f", tt.got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package deco
+
+import (
+	"errors"
+	"math"
+)
+
+// The kinds of Segment in a Schedule.
+const (
+	SegmentDescent = "descent"
+	SegmentAscent  = "ascent"
+	SegmentLevel   = "level"
+	SegmentStop    = "stop"
+)
+
+const (
+	// stopInterval is the distance between decompression stops in metres.
+	stopInterval = 3.0
+	// exposureStep is the longest time in minutes that the partial pressure of
+	// oxygen is taken to be constant for when working out oxygen toxicity.
+	exposureStep = 0.1
+	// maxStopMinutes is the longest that a single stop may last before a plan
+	// is rejected as unreasonable.
+	maxStopMinutes = 24 * 60
+)
+
+// The defaults used for a Plan's optional fields.
+const (
+	DefaultDescentRate = 18.0
+	DefaultAscentRate  = 9.0
+	DefaultLastStop    = 3.0
+	DefaultMaxDecoPPO2 = 1.6
+)
+
+// ErrTooMuchDeco is returned by Plan.Run if a decompression stop would last
+// longer than a day, which only happens for plans that are far beyond what
+// can be dived.
+var ErrTooMuchDeco = errors.New("deco: plan needs an unreasonable amount of decompression")
+
+// Level is a part of a planned dive spent at a constant depth, breathing from
+// the cylinder with the given index. The time spent travelling to the depth
+// from the previous level is not included in Minutes.
+type Level struct {
+	Depth    float64
+	Minutes  float64
+	Cylinder int
+}
+
+// Cylinder is a cylinder that may be breathed from during a planned dive. The
+// Size is the water capacity in litres and the Pressure is the pressure that
+// it is filled to in bar. Either may be zero if it is not known, in which case
+// the pressure that will be used from the cylinder cannot be worked out.
+type Cylinder struct {
+	Gas      Gas
+	Size     float64
+	Pressure float64
+}
+
+// Plan describes a dive to plan. The diver descends to each of the Levels in
+// turn and then ascends to the surface, making any decompression stops needed
+// to keep the pressure of inert gas in each tissue compartment within the
+// gradient factors.
+//
+// During the ascent, the diver switches to the cylinder with the richest gas
+// that can be breathed at the current depth with a partial pressure of oxygen
+// of no more than MaxDecoPPO2. The SAC rate in litres per minute is used to
+// work out how much gas is breathed from each cylinder. Any of the rates,
+// LastStop and MaxDecoPPO2 that are zero take their defaults.
+type Plan struct {
+	Levels      []Level
+	Cylinders   []Cylinder
+	GFLow       float64
+	GFHigh      float64
+	DescentRate float64
+	AscentRate  float64
+	LastStop    float64
+	MaxDecoPPO2 float64
+	SAC         float64
+	// Tissues are the diver's tissues at the start of the dive. If nil, they
+	// are taken to be saturated with air at the surface.
+	Tissues *Tissues
+}
+
+// Segment is a part of a Schedule spent travelling between two depths, or at
+// a single depth, breathing from the cylinder with the given index. The
+// Runtime is the time since the start of the dive at the end of the segment.
+type Segment struct {
+	Kind       string
+	StartDepth float64
+	EndDepth   float64
+	Minutes    float64
+	Runtime    float64
+	Cylinder   int
+}
+
+// Stop is a decompression stop in a Schedule.
+type Stop struct {
+	Depth    float64
+	Minutes  int
+	Runtime  float64
+	Cylinder int
+}
+
+// Schedule is the result of running a Plan. GasUsed holds the volume of gas at
+// the surface in litres breathed from each of the plan's cylinders. CNS is the
+// percentage of the central nervous system oxygen toxicity limit used, and
+// OTU is the number of oxygen tolerance units accrued. Tissues are the diver's
+// tissues on surfacing.
+type Schedule struct {
+	Segments []Segment
+	Stops    []Stop
+	Runtime  float64
+	GasUsed  []float64
+	CNS      float64
+	OTU      float64
+	Tissues  Tissues
+}
+
+// planner holds the state of a Plan as it runs.
+type planner struct {
+	plan     Plan
+	tissues  Tissues
+	depth    float64
+	cylinder int
+	schedule *Schedule
+}
+
+// Run works out the Schedule for the Plan. The plan must have been checked to
+// have at least one level, and cylinders for all of its levels.
+func (p Plan) Run() (*Schedule, error) {
+	p.DescentRate = orDefault(p.DescentRate, DefaultDescentRate)
+	p.AscentRate = orDefault(p.AscentRate, DefaultAscentRate)
+	p.LastStop = orDefault(p.LastStop, DefaultLastStop)
+	p.MaxDecoPPO2 = orDefault(p.MaxDecoPPO2, DefaultMaxDecoPPO2)
+
+	pl := &planner{
+		plan:     p,
+		tissues:  NewTissues(),
+		schedule: &Schedule{GasUsed: make([]float64, len(p.Cylinders))},
+	}
+	if p.Tissues != nil {
+		pl.tissues = *p.Tissues
+	}
+
+	for _, level := range p.Levels {
+		pl.cylinder = level.Cylinder
+
+		kind, rate := SegmentDescent, p.DescentRate
+		if level.Depth < pl.depth {
+			kind, rate = SegmentAscent, p.AscentRate
+		}
+		pl.travel(kind, level.Depth, rate)
+		pl.stay(SegmentLevel, level.Minutes)
+	}
+
+	err := pl.ascend()
+	if err != nil {
+		return nil, err
+	}
+
+	pl.schedule.Tissues = pl.tissues
+
+	return pl.schedule, nil
+}
+
+func orDefault(f, def float64) float64 {
+	if f == 0 {
+		return def
+	}
+
+	return f
+}
+
+// ascend brings the diver from their current depth to the surface, stopping at
+// each stop depth for as many whole minutes as it takes for the tissues to
+// allow them to ascend to the next. The gradient factor used rises from GFLow
+// at the first stop to GFHigh at the surface.
+func (pl *planner) ascend() error {
+	firstStop := 0.0
+	gfAt := func(depth float64) float64 {
+		if firstStop == 0 {
+			return pl.plan.GFLow
+		}
+		return pl.plan.GFHigh - (pl.plan.GFHigh-pl.plan.GFLow)*depth/firstStop
+	}
+
+	for pl.depth > 0 {
+		pl.switchGas()
+		next := pl.nextStop()
+
+		minutes := 0
+		for !pl.canAscend(next, gfAt) {
+			if firstStop == 0 {
+				firstStop = pl.depth
+			}
+			if minutes == maxStopMinutes {
+				return ErrTooMuchDeco
+			}
+
+			pl.expose(pl.depth, pl.depth, 1)
+			minutes++
+		}
+
+		if minutes > 0 {
+			pl.record(SegmentStop, pl.depth, pl.depth, float64(minutes))
+			pl.schedule.Stops = append(pl.schedule.Stops, Stop{
+				Depth:    pl.depth,
+				Minutes:  minutes,
+				Runtime:  pl.schedule.Runtime,
+				Cylinder: pl.cylinder,
+			})
+		}
+
+		pl.travel(SegmentAscent, next, pl.plan.AscentRate)
+	}
+
+	return nil
+}
+
+// nextStop returns the depth that the diver ascends to next, which is the
+// next stop depth above them, or the surface if that is shallower than the
+// last stop.
+func (pl *planner) nextStop() float64 {
+	next := (math.Ceil(pl.depth/stopInterval-1e-9) - 1) * stopInterval
+	if next < pl.plan.LastStop-1e-9 {
+		return 0
+	}
+
+	return next
+}
+
+// canAscend reports whether the diver could ascend to the given depth from
+// their current depth without passing the ceiling there.
+func (pl *planner) canAscend(to float64, gfAt func(float64) float64) bool {
+	trial := pl.tissues
+	trial.Expose(pl.depth, to, (pl.depth-to)/pl.plan.AscentRate, pl.plan.Cylinders[pl.cylinder].Gas)
+
+	return trial.Ceiling(gfAt(to)) <= to+1e-9
+}
+
+// switchGas switches to the cylinder with the most oxygen that can be breathed
+// at the current depth, if it has more oxygen than the current one. The depth
+// at which each gas can be switched to is its MOD rounded down to a stop, so
+// that its partial pressure of oxygen never exceeds MaxDecoPPO2.
+func (pl *planner) switchGas() {
+	best := pl.cylinder
+	for i, cyl := range pl.plan.Cylinders {
+		switchDepth := math.Floor(cyl.Gas.MOD(pl.plan.MaxDecoPPO2)/stopInterval+1e-9) * stopInterval
+		if cyl.Gas.O2 > pl.plan.Cylinders[best].Gas.O2 && pl.depth <= switchDepth+1e-9 {
+			best = i
+		}
+	}
+
+	pl.cylinder = best
+}
+
+// travel moves the diver from their current depth to the given depth at the
+// given rate in metres per minute.
+func (pl *planner) travel(kind string, to, rate float64) {
+	if to == pl.depth {
+		return
+	}
+
+	minutes := math.Abs(to-pl.depth) / rate
+	from := pl.depth
+	pl.expose(from, to, minutes)
+	pl.record(kind, from, to, minutes)
+}
+
+// stay keeps the diver at their current depth for the given number of minutes.
+func (pl *planner) stay(kind string, minutes float64) {
+	pl.expose(pl.depth, pl.depth, minutes)
+	pl.record(kind, pl.depth, pl.depth, minutes)
+}
+
+// expose loads the diver's tissues and adds up the gas breathed and oxygen
+// exposure for the given number of minutes spent moving between two depths on
+// the current cylinder, leaving the diver at the second depth.
+func (pl *planner) expose(from, to, minutes float64) {
+	gas := pl.plan.Cylinders[pl.cylinder].Gas
+	pl.tissues.Expose(from, to, minutes, gas)
+
+	// The SAC rate is measured at the surface, where the pressure is taken to
+	// be one bar, as it is when the SAC rates of logged dives are worked out.
+	avgDepth := (from + to) / 2
+	pl.schedule.GasUsed[pl.cylinder] += pl.plan.SAC * (1 + avgDepth/metresPerBar) * minutes
+
+	steps := math.Ceil(minutes / exposureStep)
+	for i := 0; i < int(steps); i++ {
+		depth := from + (to-from)*(float64(i)+0.5)/steps
+		ppo2 := gas.PPO2(depth)
+		pl.schedule.CNS += cnsPerMinute(ppo2) * minutes / steps
+		pl.schedule.OTU += otuPerMinute(ppo2) * minutes / steps
+	}
+
+	pl.depth = to
+}
+
+// record adds a segment to the schedule, merging it into the previous segment
+// if it carries straight on from it.
+func (pl *planner) record(kind string, from, to, minutes float64) {
+	s := pl.schedule
+	s.Runtime += minutes
+
+	if n := len(s.Segments); n > 0 {
+		last := &s.Segments[n-1]
+		if last.Kind == kind && kind == SegmentAscent && last.Cylinder == pl.cylinder && last.EndDepth == from {
+			last.EndDepth = to
+			last.Minutes += minutes
+			last.Runtime = s.Runtime
+			return
+		}
+	}
+
+	s.Segments = append(s.Segments, Segment{
+		Kind:       kind,
+		StartDepth: from,
+		EndDepth:   to,
+		Minutes:    minutes,
+		Runtime:    s.Runtime,
+		Cylinder:   pl.cylinder,
+	})
+}
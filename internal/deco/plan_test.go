@@ -0,0 +1,166 @@
+package deco
+
+import (
+	"math"
+	"testing"
+)
+
+// The expected schedules were checked against a separate implementation of
+// ZHL-16C with gradient factors that integrates the tissue loading
+// numerically instead of with the Schreiner equation. They use the default
+// rates, stops and deco ppO2 limit.
+func TestPlanRun(t *testing.T) {
+	type stop struct {
+		depth    float64
+		minutes  int
+		cylinder int
+	}
+
+	tx1845 := Cylinder{Gas: Gas{O2: 0.18, He: 0.45}}
+	ean50 := Cylinder{Gas: Gas{O2: 0.5}}
+	oxygen := Cylinder{Gas: Gas{O2: 1}}
+
+	tests := []struct {
+		name    string
+		plan    Plan
+		stops   []stop
+		runtime float64
+		cns     float64
+		otu     float64
+	}{
+		{
+			name: "30 m for 40 minutes on air at GF 30/70",
+			plan: Plan{
+				Levels:    []Level{{Depth: 30, Minutes: 40}},
+				Cylinders: []Cylinder{{Gas: Air}},
+				GFLow:     0.3,
+				GFHigh:    0.7,
+			},
+			stops:   []stop{{15, 1, 0}, {12, 2, 0}, {9, 7, 0}, {6, 13, 0}, {3, 30, 0}},
+			runtime: 98,
+			cns:     10.33,
+			otu:     30.42,
+		},
+		{
+			name: "30 m for 40 minutes on air at GF 100/100",
+			plan: Plan{
+				Levels:    []Level{{Depth: 30, Minutes: 40}},
+				Cylinders: []Cylinder{{Gas: Air}},
+				GFLow:     1,
+				GFHigh:    1,
+			},
+			stops:   []stop{{6, 3, 0}, {3, 16, 0}},
+			runtime: 64,
+			cns:     10.19,
+			otu:     30.33,
+		},
+		{
+			name: "60 m for 20 minutes on trimix 18/45 with EAN50 and oxygen at GF 30/70",
+			plan: Plan{
+				Levels:    []Level{{Depth: 60, Minutes: 20}},
+				Cylinders: []Cylinder{tx1845, ean50, oxygen},
+				GFLow:     0.3,
+				GFHigh:    0.7,
+			},
+			stops: []stop{
+				{30, 1, 0}, {27, 1, 0}, {24, 3, 0},
+				{21, 1, 1}, {18, 2, 1}, {15, 2, 1}, {12, 5, 1}, {9, 6, 1}, {6, 12, 1},
+				{3, 16, 2},
+			},
+			runtime: 79,
+			cns:     33.66,
+			otu:     89.71,
+		},
+		{
+			name: "18 m for 20 minutes on air at GF 30/70",
+			plan: Plan{
+				Levels:    []Level{{Depth: 18, Minutes: 20}},
+				Cylinders: []Cylinder{{Gas: Air}},
+				GFLow:     0.3,
+				GFHigh:    0.7,
+			},
+			stops:   []stop{{6, 1, 0}},
+			runtime: 24,
+			cns:     2.88,
+			otu:     4.95,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := tt.plan.Run()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(s.Stops) != len(tt.stops) {
+				t.Fatalf("got %d stops, want %d: %+v", len(s.Stops), len(tt.stops), s.Stops)
+			}
+			for i, want := range tt.stops {
+				got := s.Stops[i]
+				if got.Depth != want.depth || got.Minutes != want.minutes || got.Cylinder != want.cylinder {
+					t.Errorf("stop %d: got %g m for %d minutes on cylinder %d, want %g m for %d minutes on cylinder %d",
+						i, got.Depth, got.Minutes, got.Cylinder, want.depth, want.minutes, want.cylinder)
+				}
+			}
+
+			if math.Abs(s.Runtime-tt.runtime) > 0.01 {
+				t.Errorf("got a runtime of %.2f minutes, want %.2f", s.Runtime, tt.runtime)
+			}
+			if math.Abs(s.CNS-tt.cns) > 0.01 {
+				t.Errorf("got a CNS of %.2f%%, want %.2f%%", s.CNS, tt.cns)
+			}
+			if math.Abs(s.OTU-tt.otu) > 0.01 {
+				t.Errorf("got %.2f OTUs, want %.2f", s.OTU, tt.otu)
+			}
+		})
+	}
+}
+
+// TestPlanRunGasSwitches checks that no gas is switched to deeper than the
+// depth at which its partial pressure of oxygen reaches MaxDecoPPO2.
+func TestPlanRunGasSwitches(t *testing.T) {
+	tests := []struct {
+		name        string
+		gas         Gas
+		maxDecoPPO2 float64
+		switchDepth float64
+	}{
+		{"EAN50", Gas{O2: 0.5}, 1.6, 21},
+		{"a mix with a MOD of 22.5 m", Gas{O2: 1.6 / AmbientPressure(22.5)}, 1.6, 21},
+		{"a mix with a MOD of exactly 24 m", Gas{O2: 1.6 / AmbientPressure(24)}, 1.6, 24},
+		{"oxygen", Gas{O2: 1}, 1.6, 3},
+		{"oxygen at 1.62 bar", Gas{O2: 1}, 1.62, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Plan{
+				Levels:      []Level{{Depth: 45, Minutes: 30}},
+				Cylinders:   []Cylinder{{Gas: Air}, {Gas: tt.gas}},
+				GFLow:       0.3,
+				GFHigh:      0.7,
+				MaxDecoPPO2: tt.maxDecoPPO2,
+			}
+
+			s, err := plan.Run()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			switchDepth := -1.0
+			for _, seg := range s.Segments {
+				if seg.Cylinder == 1 {
+					switchDepth = seg.StartDepth
+					break
+				}
+			}
+			if switchDepth != tt.switchDepth {
+				t.Errorf("got a switch at %g m, want %g m", switchDepth, tt.switchDepth)
+			}
+			if ppo2 := tt.gas.PPO2(switchDepth); ppo2 > tt.maxDecoPPO2+1e-9 {
+				t.Errorf("got a ppO2 of %.3f bar at the switch, want no more than %.2f", ppo2, tt.maxDecoPPO2)
+			}
+		})
+	}
+}
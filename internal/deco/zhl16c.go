@@ -0,0 +1,133 @@
+// Package deco models the nitrogen and helium that a diver's body takes up and
+// gives off during dives using the Bühlmann ZHL-16C algorithm with gradient
+// factors, and plans decompression schedules with it. It also works out the
+// limits of breathing gases and how to blend them.
+//
+// Depths are in metres of sea water, pressures are in bar and times are in
+// minutes. Gradient factors are fractions between zero and one.
+package deco
+
+import (
+	"math"
+)
+
+const (
+	// SurfacePressure is the atmospheric pressure at sea level in bar.
+	SurfacePressure = 1.01325
+	// metresPerBar is the depth of sea water that adds one bar of pressure.
+	metresPerBar = 10.0
+	// waterVapourPressure is the pressure of water vapour in the lungs, which
+	// reduces the pressure of the inert gases that are breathed in.
+	waterVapourPressure = 0.0627
+	// airN2 is the fraction of nitrogen in air.
+	airN2 = 0.7902
+)
+
+// compartment holds the half-times in minutes and the a and b coefficients of
+// a single tissue compartment for nitrogen and helium.
+type compartment struct {
+	n2HalfTime, n2A, n2B float64
+	heHalfTime, heA, heB float64
+}
+
+// zhl16c holds the ZHL-16C coefficients, using the 1b variant of the first
+// compartment.
+var zhl16c = [16]compartment{
+	{5.0, 1.1696, 0.5578, 1.88, 1.6189, 0.4770},
+	{8.0, 1.0000, 0.6514, 3.02, 1.3830, 0.5747},
+	{12.5, 0.8618, 0.7222, 4.72, 1.1919, 0.6527},
+	{18.5, 0.7562, 0.7825, 6.99, 1.0458, 0.7223},
+	{27.0, 0.6200, 0.8126, 10.21, 0.9220, 0.7582},
+	{38.3, 0.5043, 0.8434, 14.48, 0.8205, 0.7957},
+	{54.3, 0.4410, 0.8693, 20.53, 0.7305, 0.8279},
+	{77.0, 0.4000, 0.8910, 29.11, 0.6502, 0.8553},
+	{109.0, 0.3750, 0.9092, 41.20, 0.5950, 0.8757},
+	{146.0, 0.3500, 0.9222, 55.19, 0.5545, 0.8903},
+	{187.0, 0.3295, 0.9319, 70.69, 0.5333, 0.8997},
+	{239.0, 0.3065, 0.9403, 90.34, 0.5189, 0.9073},
+	{305.0, 0.2835, 0.9477, 115.29, 0.5181, 0.9122},
+	{390.0, 0.2610, 0.9544, 147.42, 0.5176, 0.9171},
+	{498.0, 0.2480, 0.9602, 188.24, 0.5172, 0.9217},
+	{635.0, 0.2327, 0.9653, 240.03, 0.5119, 0.9267},
+}
+
+// AmbientPressure returns the pressure in bar at the given depth.
+func AmbientPressure(depth float64) float64 {
+	return SurfacePressure + depth/metresPerBar
+}
+
+// depthAt returns the depth at which the given ambient pressure is reached.
+func depthAt(pressure float64) float64 {
+	return (pressure - SurfacePressure) * metresPerBar
+}
+
+// Tissues holds the pressures of nitrogen and helium in each of the ZHL-16C
+// compartments. The zero value is not useful; use NewTissues instead. Tissues
+// can be copied to try out an ascent without changing the original.
+type Tissues struct {
+	n2 [16]float64
+	he [16]float64
+}
+
+// NewTissues returns Tissues saturated with air at the surface, as they are
+// before a diver's first dive.
+func NewTissues() Tissues {
+	var t Tissues
+	for i := range t.n2 {
+		t.n2[i] = (SurfacePressure - waterVapourPressure) * airN2
+	}
+
+	return t
+}
+
+// Expose loads the tissues as if the given gas was breathed for the given
+// number of minutes while moving at a steady rate from one depth to another.
+// The depths may be the same, for time spent at a constant depth, or zero, for
+// time spent breathing the gas at the surface.
+func (t *Tissues) Expose(from, to, minutes float64, gas Gas) {
+	if minutes <= 0 {
+		return
+	}
+
+	start := AmbientPressure(from) - waterVapourPressure
+	rate := (AmbientPressure(to) - AmbientPressure(from)) / minutes
+
+	for i, c := range zhl16c {
+		t.n2[i] = schreiner(t.n2[i], start*gas.N2(), rate*gas.N2(), c.n2HalfTime, minutes)
+		t.he[i] = schreiner(t.he[i], start*gas.He, rate*gas.He, c.heHalfTime, minutes)
+	}
+}
+
+// schreiner works out the pressure of an inert gas in a compartment with the
+// given half-time after the given number of minutes, starting from pressure p
+// while breathing the gas at an inspired pressure that starts at inspired and
+// changes by rate every minute.
+func schreiner(p, inspired, rate, halfTime, minutes float64) float64 {
+	k := math.Ln2 / halfTime
+	return inspired + rate*(minutes-1/k) - (inspired-p-rate/k)*math.Exp(-k*minutes)
+}
+
+// Ceiling returns the shallowest depth that a diver with these tissues can
+// ascend to without the pressure of inert gas in any compartment exceeding the
+// given fraction of its M-value. A ceiling of zero means that they can ascend
+// to the surface.
+func (t *Tissues) Ceiling(gf float64) float64 {
+	return math.Max(0, depthAt(t.tolerated(gf)))
+}
+
+// tolerated returns the lowest ambient pressure that a diver with these
+// tissues can be exposed to without the pressure of inert gas in any
+// compartment exceeding the given fraction of its M-value.
+func (t *Tissues) tolerated(gf float64) float64 {
+	var tolerated float64
+
+	for i, c := range zhl16c {
+		p := t.n2[i] + t.he[i]
+		a := (c.n2A*t.n2[i] + c.heA*t.he[i]) / p
+		b := (c.n2B*t.n2[i] + c.heB*t.he[i]) / p
+
+		tolerated = math.Max(tolerated, (p-a*gf)/(gf/b+1-gf))
+	}
+
+	return tolerated
+}
@@ -0,0 +1,126 @@
+package deco
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSchreiner(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        float64
+		inspired float64
+		rate     float64
+		halfTime float64
+		minutes  float64
+		want     float64
+	}{
+		{"no time", 0.75, 3.1, 0, 5, 0, 0.75},
+		{"one half-time", 0.75, 3.15, 0, 5, 5, 1.95},
+		{"two half-times", 0.75, 3.15, 0, 5, 10, 2.55},
+		{"offgassing", 2.0, 1.0, 0, 10, 10, 1.5},
+		{"saturated", 3.0, 3.0, 0, 635, 1000, 3.0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := schreiner(tt.p, tt.inspired, tt.rate, tt.halfTime, tt.minutes)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %.6f, want %.6f", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestZHL16CCoefficients checks the coefficients against the ZHL-16C table in
+// A. A. Bühlmann, E. B. Völlm and P. Nussberger, Tauchmedizin, 5th edition,
+// Springer, 2002, using compartment 1b. As the book describes, each helium
+// half-time is also, to within rounding, the nitrogen one divided by the square
+// root of the ratio of the molecular weights of nitrogen and helium, 28/4.
+func TestZHL16CCoefficients(t *testing.T) {
+	published := [16]compartment{
+		{5.0, 1.1696, 0.5578, 1.88, 1.6189, 0.4770},
+		{8.0, 1.0000, 0.6514, 3.02, 1.3830, 0.5747},
+		{12.5, 0.8618, 0.7222, 4.72, 1.1919, 0.6527},
+		{18.5, 0.7562, 0.7825, 6.99, 1.0458, 0.7223},
+		{27.0, 0.6200, 0.8126, 10.21, 0.9220, 0.7582},
+		{38.3, 0.5043, 0.8434, 14.48, 0.8205, 0.7957},
+		{54.3, 0.4410, 0.8693, 20.53, 0.7305, 0.8279},
+		{77.0, 0.4000, 0.8910, 29.11, 0.6502, 0.8553},
+		{109.0, 0.3750, 0.9092, 41.20, 0.5950, 0.8757},
+		{146.0, 0.3500, 0.9222, 55.19, 0.5545, 0.8903},
+		{187.0, 0.3295, 0.9319, 70.69, 0.5333, 0.8997},
+		{239.0, 0.3065, 0.9403, 90.34, 0.5189, 0.9073},
+		{305.0, 0.2835, 0.9477, 115.29, 0.5181, 0.9122},
+		{390.0, 0.2610, 0.9544, 147.42, 0.5176, 0.9171},
+		{498.0, 0.2480, 0.9602, 188.24, 0.5172, 0.9217},
+		{635.0, 0.2327, 0.9653, 240.03, 0.5119, 0.9267},
+	}
+
+	for i, want := range published {
+		if got := zhl16c[i]; got != want {
+			t.Errorf("compartment %d: got %+v, want %+v", i+1, got, want)
+		}
+
+		heHalfTime := want.n2HalfTime / math.Sqrt(28.0/4.0)
+		if math.Abs(zhl16c[i].heHalfTime-heHalfTime) > 0.01*heHalfTime {
+			t.Errorf("compartment %d: got a helium half-time of %.2f, want %.2f",
+				i+1, zhl16c[i].heHalfTime, heHalfTime)
+		}
+	}
+}
+
+// TestSchreinerRate checks the pressure loaded while the inspired pressure
+// changes against the sum of many short exposures at a constant pressure.
+func TestSchreinerRate(t *testing.T) {
+	const (
+		p        = 0.75
+		inspired = 0.75
+		rate     = 1.4
+		halfTime = 12.5
+		minutes  = 2.0
+		steps    = 100000
+	)
+
+	want := p
+	dt := minutes / steps
+	for i := 0; i < steps; i++ {
+		pi := inspired + rate*(float64(i)+0.5)*dt
+		want = schreiner(want, pi, 0, halfTime, dt)
+	}
+
+	got := schreiner(p, inspired, rate, halfTime, minutes)
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("got %.6f, want %.6f", got, want)
+	}
+}
+
+func TestCeiling(t *testing.T) {
+	surface := NewTissues()
+
+	saturated := NewTissues()
+	saturated.Expose(30, 30, 100000, Air)
+
+	tests := []struct {
+		name    string
+		tissues Tissues
+		gf      float64
+		want    float64
+	}{
+		{"surface at gf 100", surface, 1, 0},
+		{"surface at gf 30", surface, 0.3, 0},
+		// For tissues saturated with air at 30 metres, the slowest compartment
+		// sets the ceiling, where p = (4.01325 - 0.0627) * 0.79.
+		{"saturated at gf 100", saturated, 1, 17.7476},
+		{"saturated at gf 70", saturated, 0.7, 18.7219},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.tissues.Ceiling(tt.gf)
+			if math.Abs(got-tt.want) > 1e-3 {
+				t.Errorf("got %.4f, want %.4f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package profile
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// encodingVersion is written at the start of every encoded profile so that
+// the format can be changed later without breaking stored profiles.
+const encodingVersion = 1
+
+// The flags that say which optional values a sample has.
+const (
+	hasTemperature byte = 1 << iota
+	hasPressure
+	hasPPO2
+)
+
+// The values are stored as integers in these units, which limits their
+// precision to centimetres, tenths of a degree, tenths of a bar and
+// hundredths of a bar respectively.
+const (
+	depthScale       = 100
+	temperatureScale = 10
+	pressureScale    = 10
+	ppo2Scale        = 100
+)
+
+// ErrCorrupt is returned by Decode if the data is not a valid encoded profile.
+var ErrCorrupt = errors.New("profile: corrupt encoded profile")
+
+// Encode encodes the given samples, which must be in order of elapsed time,
+// into a compact binary form. Each value is stored as the difference from the
+// previous value of the same kind as a variable length integer, so a typical
+// sample takes three or four bytes. Values are rounded to the precision that
+// they are stored with.
+//
+// The format is a version byte and the number of samples, followed by each
+// sample as a byte of flags saying which optional values it has, the elapsed
+// time, the depth and then any optional values.
+func Encode(samples []Sample) []byte {
+	buf := make([]byte, 0, 1+binary.MaxVarintLen64+len(samples)*4)
+	buf = append(buf, encodingVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(samples)))
+
+	var prevElapsed int
+	var prevDepth, prevTemp, prevPressure, prevPPO2 int64
+
+	for _, s := range samples {
+		var flags byte
+		if s.Temperature != nil {
+			flags |= hasTemperature
+		}
+		if s.Pressure != nil {
+			flags |= hasPressure
+		}
+		if s.PPO2 != nil {
+			flags |= hasPPO2
+		}
+		buf = append(buf, flags)
+
+		buf = binary.AppendUvarint(buf, uint64(s.Elapsed-prevElapsed))
+		prevElapsed = s.Elapsed
+
+		buf, prevDepth = appendDelta(buf, s.Depth, depthScale, prevDepth)
+		if s.Temperature != nil {
+			buf, prevTemp = appendDelta(buf, *s.Temperature, temperatureScale, prevTemp)
+		}
+		if s.Pressure != nil {
+			buf, prevPressure = appendDelta(buf, *s.Pressure, pressureScale, prevPressure)
+		}
+		if s.PPO2 != nil {
+			buf, prevPPO2 = appendDelta(buf, *s.PPO2, ppo2Scale, prevPPO2)
+		}
+	}
+
+	return buf
+}
+
+// appendDelta scales f to an integer and appends its difference from prev to
+// buf. The scaled value is returned to be used as the next prev.
+func appendDelta(buf []byte, f float64, scale float64, prev int64) ([]byte, int64) {
+	v := int64(math.Round(f * scale))
+	return binary.AppendVarint(buf, v-prev), v
+}
+
+// Decode decodes a profile encoded by Encode. If the data is not a valid
+// encoded profile, ErrCorrupt is returned.
+func Decode(data []byte) ([]Sample, error) {
+	d := decoder{data: data}
+
+	version := d.byte()
+	if d.err == nil && version != encodingVersion {
+		return nil, fmt.Errorf("profile: unsupported encoding version %d", version)
+	}
+
+	count := d.uvarint()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	// Every sample takes at least three bytes, which stops a corrupt count
+	// from allocating a huge slice.
+	if count > uint64(len(data)/3) {
+		return nil, ErrCorrupt
+	}
+
+	samples := make([]Sample, 0, count)
+
+	var elapsed int
+	var depth, temp, pressure, ppo2 int64
+
+	for i := uint64(0); i < count; i++ {
+		flags := d.byte()
+		elapsed += int(d.uvarint())
+		depth += d.varint()
+
+		s := Sample{Elapsed: elapsed, Depth: float64(depth) / depthScale}
+		if flags&hasTemperature != 0 {
+			temp += d.varint()
+			s.Temperature = scaled(temp, temperatureScale)
+		}
+		if flags&hasPressure != 0 {
+			pressure += d.varint()
+			s.Pressure = scaled(pressure, pressureScale)
+		}
+		if flags&hasPPO2 != 0 {
+			ppo2 += d.varint()
+			s.PPO2 = scaled(ppo2, ppo2Scale)
+		}
+
+		if d.err != nil {
+			return nil, d.err
+		}
+
+		samples = append(samples, s)
+	}
+
+	if len(d.data) != 0 {
+		return nil, ErrCorrupt
+	}
+
+	return samples, nil
+}
+
+func scaled(v int64, scale float64) *float64 {
+	f := float64(v) / scale
+	return &f
+}
+
+// decoder reads values from the start of data. Once a value cannot be read,
+// err is set to ErrCorrupt and all further reads return zero.
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil || len(d.data) == 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+
+	b := d.data[0]
+	d.data = d.data[1:]
+
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	d.data = d.data[n:]
+
+	return v
+}
@@ -0,0 +1,157 @@
+// Package profile stores, summarises and downsamples the depth profiles that
+// dive computers record. A profile is a series of Samples taken every few
+// seconds during a dive, which are stored compactly by Encode and Decode.
+package profile
+
+import (
+	"math"
+)
+
+// MaxAscentRate is the fastest safe ascent rate in metres per minute. Ascents
+// faster than this are counted as violations in a profile's Summary.
+const MaxAscentRate = 10.0
+
+// ascentWindow is the shortest period in seconds that ascent rates are
+// measured over, so that noise between closely spaced samples is not mistaken
+// for a fast ascent.
+const ascentWindow = 30
+
+// Sample is a single point of a dive's profile, recorded Elapsed seconds after
+// the dive started. The depth is in metres, the temperature in degrees
+// Celsius, and the tank pressure and partial pressure of oxygen in bar. The
+// optional values are nil if they were not recorded.
+type Sample struct {
+	Elapsed     int      `json:"elapsed"`
+	Depth       float64  `json:"depth"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Pressure    *float64 `json:"pressure,omitempty"`
+	PPO2        *float64 `json:"ppo2,omitempty"`
+}
+
+// Summary holds the values worked out from a whole profile. The duration is in
+// seconds, depths are in metres and the ascent rate is in metres per minute.
+// The average depth is weighted by time, so it does not depend on how often
+// samples were taken.
+type Summary struct {
+	Samples          int     `json:"samples"`
+	Duration         int     `json:"duration"`
+	MaxDepth         float64 `json:"max_depth"`
+	AvgDepth         float64 `json:"avg_depth"`
+	MaxAscentRate    float64 `json:"max_ascent_rate"`
+	AscentViolations int     `json:"ascent_violations"`
+}
+
+// Summarise works out the Summary of the given samples, which must be in order
+// of elapsed time. Each continuous period of ascending faster than
+// MaxAscentRate counts as one violation, however long it lasts.
+func Summarise(samples []Sample) Summary {
+	s := Summary{Samples: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+
+	var area float64
+	violating := false
+
+	for i, sample := range samples {
+		s.MaxDepth = math.Max(s.MaxDepth, sample.Depth)
+
+		if i == 0 {
+			continue
+		}
+
+		prev := samples[i-1]
+		area += float64(sample.Elapsed-prev.Elapsed) * (sample.Depth + prev.Depth) / 2
+
+		rate, ok := ascentRate(samples, i)
+		if !ok {
+			continue
+		}
+
+		s.MaxAscentRate = math.Max(s.MaxAscentRate, rate)
+		if rate > MaxAscentRate && !violating {
+			s.AscentViolations++
+		}
+		violating = rate > MaxAscentRate
+	}
+
+	s.Duration = samples[len(samples)-1].Elapsed - samples[0].Elapsed
+	if s.Duration > 0 {
+		s.AvgDepth = round(area/float64(s.Duration), 100)
+	}
+	s.MaxAscentRate = round(s.MaxAscentRate, 10)
+
+	return s
+}
+
+// ascentRate works out the rate of ascent in metres per minute up to the
+// sample at index i, measured from the latest sample at least ascentWindow
+// seconds before it. Descents give a negative rate. If there is no such
+// sample, false is returned.
+func ascentRate(samples []Sample, i int) (float64, bool) {
+	for j := i - 1; j >= 0; j-- {
+		secs := samples[i].Elapsed - samples[j].Elapsed
+		if secs >= ascentWindow {
+			return (samples[j].Depth - samples[i].Depth) / float64(secs) * 60, true
+		}
+	}
+
+	return 0, false
+}
+
+// Downsample reduces the given samples to at most n points using the Largest
+// Triangle Three Buckets algorithm, which keeps the points that contribute
+// most to the shape of the depth profile. The first and last samples are
+// always kept. If there are already n or fewer samples, or n is less than 3,
+// the samples are returned unchanged.
+func Downsample(samples []Sample, n int) []Sample {
+	if n >= len(samples) || n < 3 {
+		return samples
+	}
+
+	out := make([]Sample, 0, n)
+	out = append(out, samples[0])
+
+	// The samples between the first and last are split into n-2 buckets, and
+	// the point from each that forms the largest triangle with the point
+	// chosen from the previous bucket and the average of the next is kept.
+	bucketSize := float64(len(samples)-2) / float64(n-2)
+	a := 0
+
+	for b := 0; b < n-2; b++ {
+		start := int(float64(b)*bucketSize) + 1
+		end := int(float64(b+1)*bucketSize) + 1
+
+		nextStart, nextEnd := end, int(float64(b+2)*bucketSize)+1
+		if nextEnd > len(samples) {
+			nextEnd = len(samples)
+		}
+
+		var avgX, avgY float64
+		for _, s := range samples[nextStart:nextEnd] {
+			avgX += float64(s.Elapsed)
+			avgY += s.Depth
+		}
+		count := float64(nextEnd - nextStart)
+		avgX, avgY = avgX/count, avgY/count
+
+		ax, ay := float64(samples[a].Elapsed), samples[a].Depth
+		maxArea, chosen := -1.0, start
+		for i := start; i < end; i++ {
+			area := math.Abs((ax-avgX)*(samples[i].Depth-ay) - (ax-float64(samples[i].Elapsed))*(avgY-ay))
+			if area > maxArea {
+				maxArea, chosen = area, i
+			}
+		}
+
+		out = append(out, samples[chosen])
+		a = chosen
+	}
+
+	return append(out, samples[len(samples)-1])
+}
+
+// round rounds f to the nearest 1/scale.
+func round(f, scale float64) float64 {
+	return math.Round(f*scale) / scale
+}
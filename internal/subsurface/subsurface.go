@@ -0,0 +1,350 @@
+// Package subsurface reads and writes dive logs in the XML format used by the
+// Subsurface dive log program. Only the parts of the format that the service
+// stores are handled: each dive's time, duration, maximum depth, water
+// temperature, site, buddies, cylinders and samples.
+//
+// Subsurface writes every value with its unit, for example "18.4 m", "25.0 C",
+// "232.0 bar", "12.0 l", "32.0%" or "42:00 min", and always uses metric units
+// in its files.
+package subsurface
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoDives is returned by Parse if the file does not contain any dives.
+var ErrNoDives = errors.New("subsurface: file contains no dives")
+
+// Site is a dive site. The latitude and longitude are in decimal degrees and
+// are nil if the site has no GPS position.
+type Site struct {
+	Name      string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// Cylinder is a cylinder breathed from on a dive. The size is the water
+// capacity in litres, pressures are in bar and the gas fractions are
+// percentages. Any unknown values are nil, except the oxygen percentage,
+// which is 21 for air.
+type Cylinder struct {
+	Description   string
+	Size          *float64
+	WorkPressure  *float64
+	StartPressure *float64
+	EndPressure   *float64
+	O2            float64
+	He            float64
+}
+
+// Sample is a single point of a dive's profile. Elapsed is the time since the
+// start of the dive and the depth is in metres. The temperature, if recorded,
+// is in degrees Celsius, and the tank pressure and partial pressure of oxygen,
+// if recorded, are in bar.
+type Sample struct {
+	Elapsed     time.Duration
+	Depth       float64
+	Temperature *float64
+	Pressure    *float64
+	PPO2        *float64
+}
+
+// Dive is a single dive in a Subsurface log. When reading a file, Err is set
+// if the dive could not be read, in which case the other fields may be
+// incomplete. Number is only written, as the service numbers dives itself.
+type Dive struct {
+	Number    int
+	StartedAt time.Time
+	Duration  time.Duration
+	MaxDepth  float64
+	// WaterTemperature is in degrees Celsius.
+	WaterTemperature *float64
+	Site             *Site
+	Buddies          []string
+	Cylinders        []Cylinder
+	Samples          []Sample
+	Err              error
+}
+
+// The xml* types mirror the structure of a Subsurface document.
+type xmlLog struct {
+	XMLName xml.Name  `xml:"divelog"`
+	Program string    `xml:"program,attr"`
+	Version string    `xml:"version,attr"`
+	Sites   []xmlSite `xml:"divesites>site"`
+	Dives   []xmlDive `xml:"dives>dive"`
+	// Older versions of Subsurface group dives into trips.
+	Trips []xmlTrip `xml:"dives>trip"`
+}
+
+type xmlTrip struct {
+	Dives []xmlDive `xml:"dive"`
+}
+
+type xmlSite struct {
+	UUID string `xml:"uuid,attr"`
+	Name string `xml:"name,attr"`
+	GPS  string `xml:"gps,attr,omitempty"`
+}
+
+type xmlDive struct {
+	Number    int             `xml:"number,attr,omitempty"`
+	Date      string          `xml:"date,attr"`
+	Time      string          `xml:"time,attr"`
+	Duration  string          `xml:"duration,attr"`
+	SiteID    string          `xml:"divesiteid,attr,omitempty"`
+	Buddy     string          `xml:"buddy,omitempty"`
+	Cylinders []xmlCylinder   `xml:"cylinder"`
+	Computers []xmlComputer   `xml:"divecomputer"`
+	Depth     *xmlDepth       `xml:"depth"`
+	Temp      *xmlTemperature `xml:"temperature"`
+}
+
+type xmlCylinder struct {
+	Size         string `xml:"size,attr,omitempty"`
+	WorkPressure string `xml:"workpressure,attr,omitempty"`
+	Description  string `xml:"description,attr,omitempty"`
+	O2           string `xml:"o2,attr,omitempty"`
+	He           string `xml:"he,attr,omitempty"`
+	Start        string `xml:"start,attr,omitempty"`
+	End          string `xml:"end,attr,omitempty"`
+}
+
+type xmlComputer struct {
+	Model   string          `xml:"model,attr,omitempty"`
+	Depth   *xmlDepth       `xml:"depth"`
+	Temp    *xmlTemperature `xml:"temperature"`
+	Samples []xmlSample     `xml:"sample"`
+}
+
+type xmlDepth struct {
+	Max string `xml:"max,attr,omitempty"`
+}
+
+type xmlTemperature struct {
+	Water string `xml:"water,attr,omitempty"`
+}
+
+type xmlSample struct {
+	Time     string `xml:"time,attr"`
+	Depth    string `xml:"depth,attr"`
+	Temp     string `xml:"temp,attr,omitempty"`
+	Pressure string `xml:"pressure,attr,omitempty"`
+	PO2      string `xml:"po2,attr,omitempty"`
+}
+
+// Parse reads a Subsurface log from r and returns the dives that it contains,
+// in the order that they appear. Dates and times are taken to be in the
+// location loc, as Subsurface records the local time of each dive. An error
+// is only returned if the document itself cannot be read; problems with
+// individual dives are reported in their Err field so that the rest of the
+// file can still be used.
+func Parse(r io.Reader, loc *time.Location) ([]*Dive, error) {
+	var log xmlLog
+
+	err := xml.NewDecoder(r).Decode(&log)
+	if err != nil {
+		return nil, fmt.Errorf("subsurface: %w", err)
+	}
+
+	sites := make(map[string]*Site, len(log.Sites))
+	for _, xs := range log.Sites {
+		site := &Site{Name: strings.TrimSpace(xs.Name)}
+		if lat, lon, ok := parseGPS(xs.GPS); ok {
+			site.Latitude, site.Longitude = &lat, &lon
+		}
+		sites[xs.UUID] = site
+	}
+
+	xmlDives := log.Dives
+	for _, trip := range log.Trips {
+		xmlDives = append(xmlDives, trip.Dives...)
+	}
+
+	dives := []*Dive{}
+	for _, xd := range xmlDives {
+		dives = append(dives, readDive(xd, sites, loc))
+	}
+
+	if len(dives) == 0 {
+		return nil, ErrNoDives
+	}
+
+	return dives, nil
+}
+
+// readDive converts a dive from the XML document into a Dive. The summary
+// values are taken from the dive itself or its first dive computer, falling
+// back to those worked out from the samples.
+func readDive(xd xmlDive, sites map[string]*Site, loc *time.Location) *Dive {
+	dive := &Dive{Site: sites[xd.SiteID]}
+
+	var err error
+	dive.StartedAt, err = time.ParseInLocation("2006-01-02 15:04:05", xd.Date+" "+xd.Time, loc)
+	if err != nil {
+		dive.Err = fmt.Errorf("subsurface: invalid date and time %q", xd.Date+" "+xd.Time)
+		return dive
+	}
+
+	for _, name := range strings.Split(xd.Buddy, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			dive.Buddies = append(dive.Buddies, name)
+		}
+	}
+
+	for _, xc := range xd.Cylinders {
+		cyl := Cylinder{
+			Description:   xc.Description,
+			Size:          parseOptional(xc.Size, "l"),
+			WorkPressure:  parseOptional(xc.WorkPressure, "bar"),
+			StartPressure: parseOptional(xc.Start, "bar"),
+			EndPressure:   parseOptional(xc.End, "bar"),
+			O2:            21,
+		}
+		if o2 := parseOptional(xc.O2, "%"); o2 != nil {
+			cyl.O2 = *o2
+		}
+		if he := parseOptional(xc.He, "%"); he != nil {
+			cyl.He = *he
+		}
+		dive.Cylinders = append(dive.Cylinders, cyl)
+	}
+
+	depth, temp := xd.Depth, xd.Temp
+
+	// Only the first dive computer's samples are used, as any others would
+	// have recorded the same dive.
+	if len(xd.Computers) > 0 {
+		dc := xd.Computers[0]
+		if depth == nil {
+			depth = dc.Depth
+		}
+		if temp == nil {
+			temp = dc.Temp
+		}
+
+		for _, xs := range dc.Samples {
+			sample, err := readSample(xs)
+			if err != nil {
+				dive.Err = err
+				return dive
+			}
+
+			dive.Samples = append(dive.Samples, sample)
+			dive.MaxDepth = math.Max(dive.MaxDepth, sample.Depth)
+			dive.Duration = max(dive.Duration, sample.Elapsed)
+			if sample.Temperature != nil && (dive.WaterTemperature == nil || *sample.Temperature < *dive.WaterTemperature) {
+				dive.WaterTemperature = sample.Temperature
+			}
+		}
+	}
+
+	if d, err := parseDuration(xd.Duration); err == nil {
+		dive.Duration = d
+	}
+	if depth != nil {
+		if maxDepth := parseOptional(depth.Max, "m"); maxDepth != nil {
+			dive.MaxDepth = *maxDepth
+		}
+	}
+	if temp != nil {
+		if water := parseOptional(temp.Water, "C"); water != nil {
+			dive.WaterTemperature = water
+		}
+	}
+
+	return dive
+}
+
+// readSample converts a sample from the XML document into a Sample.
+func readSample(xs xmlSample) (Sample, error) {
+	elapsed, err := parseDuration(xs.Time)
+	if err != nil {
+		return Sample{}, err
+	}
+
+	depth, err := parseValue(xs.Depth, "m")
+	if err != nil || depth < 0 {
+		return Sample{}, fmt.Errorf("subsurface: invalid sample depth %q", xs.Depth)
+	}
+
+	return Sample{
+		Elapsed:     elapsed,
+		Depth:       depth,
+		Temperature: parseOptional(xs.Temp, "C"),
+		Pressure:    parseOptional(xs.Pressure, "bar"),
+		PPO2:        parseOptional(xs.PO2, "bar"),
+	}, nil
+}
+
+// parseValue parses a number followed by the given unit, such as "18.4 m".
+func parseValue(s, unit string) (float64, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), unit))
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("subsurface: invalid value %q", s)
+	}
+
+	return f, nil
+}
+
+// parseOptional behaves like parseValue, but returns nil if the value is
+// missing or invalid.
+func parseOptional(s, unit string) *float64 {
+	if s == "" {
+		return nil
+	}
+
+	f, err := parseValue(s, unit)
+	if err != nil {
+		return nil
+	}
+
+	return &f
+}
+
+// parseDuration parses a duration in the "minutes:seconds min" format, such as
+// "42:30 min".
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "min"))
+
+	mins, secs, found := strings.Cut(s, ":")
+	m, err := strconv.Atoi(mins)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("subsurface: invalid duration %q", s)
+	}
+
+	sec := 0
+	if found {
+		sec, err = strconv.Atoi(secs)
+		if err != nil || sec < 0 || sec > 59 {
+			return 0, fmt.Errorf("subsurface: invalid duration %q", s)
+		}
+	}
+
+	return time.Duration(m)*time.Minute + time.Duration(sec)*time.Second, nil
+}
+
+// parseGPS parses a GPS position in the "latitude longitude" format.
+func parseGPS(s string) (float64, float64, bool) {
+	fields := strings.Fields(s)
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+
+	lat, err1 := strconv.ParseFloat(fields[0], 64)
+	lon, err2 := strconv.ParseFloat(fields[1], 64)
+	if err1 != nil || err2 != nil {
+		return 0, 0, false
+	}
+
+	return lat, lon, true
+}
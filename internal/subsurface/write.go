@@ -0,0 +1,117 @@
+package subsurface
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+	"time"
+)
+
+// Write writes the given dives to w as a Subsurface log that Subsurface can
+// open. Dates and times are written in the location loc. Dives that share a
+// site with the same name and position refer to a single site in the log.
+func Write(w io.Writer, dives []*Dive, loc *time.Location) error {
+	log := xmlLog{Program: "subsurface", Version: "3"}
+
+	siteIDs := make(map[string]string)
+	for _, dive := range dives {
+		xd := xmlDive{
+			Number:   dive.Number,
+			Date:     dive.StartedAt.In(loc).Format("2006-01-02"),
+			Time:     dive.StartedAt.In(loc).Format("15:04:05"),
+			Duration: formatDuration(dive.Duration),
+			Buddy:    strings.Join(dive.Buddies, ", "),
+		}
+
+		if dive.Site != nil {
+			xs := xmlSite{Name: dive.Site.Name}
+			if dive.Site.Latitude != nil && dive.Site.Longitude != nil {
+				xs.GPS = fmt.Sprintf("%.6f %.6f", *dive.Site.Latitude, *dive.Site.Longitude)
+			}
+
+			key := xs.Name + "|" + xs.GPS
+			id, ok := siteIDs[key]
+			if !ok {
+				id = siteUUID(key)
+				siteIDs[key] = id
+				xs.UUID = id
+				log.Sites = append(log.Sites, xs)
+			}
+			xd.SiteID = id
+		}
+
+		for _, cyl := range dive.Cylinders {
+			xd.Cylinders = append(xd.Cylinders, xmlCylinder{
+				Description:  cyl.Description,
+				Size:         formatOptional(cyl.Size, "%.1f l"),
+				WorkPressure: formatOptional(cyl.WorkPressure, "%.1f bar"),
+				Start:        formatOptional(cyl.StartPressure, "%.1f bar"),
+				End:          formatOptional(cyl.EndPressure, "%.1f bar"),
+				O2:           fmt.Sprintf("%.1f%%", cyl.O2),
+				He:           fmt.Sprintf("%.1f%%", cyl.He),
+			})
+		}
+
+		dc := xmlComputer{
+			Model: "go-dive",
+			Depth: &xmlDepth{Max: fmt.Sprintf("%.2f m", dive.MaxDepth)},
+		}
+		if dive.WaterTemperature != nil {
+			dc.Temp = &xmlTemperature{Water: fmt.Sprintf("%.1f C", *dive.WaterTemperature)}
+		}
+		for _, s := range dive.Samples {
+			dc.Samples = append(dc.Samples, xmlSample{
+				Time:     formatDuration(s.Elapsed),
+				Depth:    fmt.Sprintf("%.2f m", s.Depth),
+				Temp:     formatOptional(s.Temperature, "%.1f C"),
+				Pressure: formatOptional(s.Pressure, "%.1f bar"),
+				PO2:      formatOptional(s.PPO2, "%.2f bar"),
+			})
+		}
+		xd.Computers = []xmlComputer{dc}
+
+		log.Dives = append(log.Dives, xd)
+	}
+
+	_, err := io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	err = enc.Encode(log)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// siteUUID derives the 32 bit hexadecimal ID that Subsurface uses for dive
+// sites from the given key, so that the same site always gets the same ID.
+func siteUUID(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// formatDuration formats a duration in the "minutes:seconds min" format.
+func formatDuration(d time.Duration) string {
+	secs := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%d:%02d min", secs/60, secs%60)
+}
+
+// formatOptional formats the given value with format, or returns an empty
+// string, which omits the attribute, if it is nil.
+func formatOptional(f *float64, format string) string {
+	if f == nil {
+		return ""
+	}
+
+	return fmt.Sprintf(format, *f)
+}
@@ -0,0 +1,258 @@
+// Package uddf reads dive logs in the Universal Dive Data Format (UDDF), the
+// XML format that most dive computers and logging programs can export to. Only
+// the parts of the format that the service stores are read: the diver's
+// buddies, the dive sites and each dive's time, depth, duration, temperature
+// and samples.
+//
+// UDDF stores all values in SI units, so depths are in metres, times are in
+// seconds and temperatures are in Kelvin. Temperatures are converted to
+// degrees Celsius when they are read.
+package uddf
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// absoluteZero is 0°C in Kelvin.
+const absoluteZero = 273.15
+
+// ErrNoDives is returned by Parse if the file does not contain any dives.
+var ErrNoDives = errors.New("uddf: file contains no dives")
+
+// datetimeLayouts are the formats that the date and time of a dive may be
+// given in. UDDF uses ISO 8601, but not all programs include the seconds or a
+// time zone offset.
+var datetimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// Buddy is a buddy of the diver who exported the file.
+type Buddy struct {
+	Name  string
+	Email string
+}
+
+// Sample is a single waypoint of a dive's profile. Elapsed is the time since
+// the start of the dive. The temperature, if recorded, is in degrees Celsius,
+// and the tank pressure and partial pressure of oxygen, if recorded, are in
+// bar.
+type Sample struct {
+	Elapsed     time.Duration
+	Depth       float64
+	Temperature *float64
+	Pressure    *float64
+	PPO2        *float64
+}
+
+// Dive is a single dive read from a UDDF file. If the dive could not be read,
+// Err describes why and the other fields may be incomplete. The Buddies and
+// Site are resolved from the references in the dive, and any references that
+// could not be resolved are ignored.
+type Dive struct {
+	ID        string
+	StartedAt time.Time
+	MaxDepth  float64
+	Duration  time.Duration
+	// MinTemperature is the lowest water temperature in degrees Celsius.
+	MinTemperature *float64
+	Site           string
+	Buddies        []Buddy
+	Samples        []Sample
+	Err            error
+}
+
+// The xml* types mirror the structure of a UDDF document.
+type xmlDocument struct {
+	XMLName     xml.Name         `xml:"uddf"`
+	Buddies     []xmlBuddy       `xml:"diver>buddy"`
+	Sites       []xmlSite        `xml:"divesite>site"`
+	Repetitions []xmlRepetitions `xml:"profiledata>repetitiongroup"`
+}
+
+type xmlBuddy struct {
+	ID        string `xml:"id,attr"`
+	FirstName string `xml:"personal>firstname"`
+	LastName  string `xml:"personal>lastname"`
+	Email     string `xml:"contact>email"`
+}
+
+type xmlSite struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"name"`
+}
+
+type xmlRepetitions struct {
+	Dives []xmlDive `xml:"dive"`
+}
+
+type xmlLink struct {
+	Ref string `xml:"ref,attr"`
+}
+
+type xmlDive struct {
+	ID        string     `xml:"id,attr"`
+	Links     []xmlLink  `xml:"informationbeforedive>link"`
+	Datetime  string     `xml:"informationbeforedive>datetime"`
+	Waypoints []xmlPoint `xml:"samples>waypoint"`
+	MaxDepth  *float64   `xml:"informationafterdive>greatestdepth"`
+	Duration  *float64   `xml:"informationafterdive>diveduration"`
+	MinTemp   *float64   `xml:"informationafterdive>lowesttemperature"`
+}
+
+type xmlPoint struct {
+	DiveTime    float64  `xml:"divetime"`
+	Depth       float64  `xml:"depth"`
+	Temperature *float64 `xml:"temperature"`
+	Pressure    *float64 `xml:"tankpressure"`
+	PPO2        *float64 `xml:"measuredpo2"`
+	CalcPPO2    *float64 `xml:"calculatedpo2"`
+}
+
+// Parse reads a UDDF document from r and returns the dives that it contains,
+// in the order that they appear. Dates and times without a time zone offset
+// are taken to be in the location loc. An error is only returned if the
+// document itself cannot be read; problems with individual dives are reported
+// in their Err field so that the rest of the file can still be used.
+func Parse(r io.Reader, loc *time.Location) ([]*Dive, error) {
+	var doc xmlDocument
+
+	err := xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("uddf: %w", err)
+	}
+
+	buddies := make(map[string]Buddy, len(doc.Buddies))
+	for _, b := range doc.Buddies {
+		name := strings.TrimSpace(strings.TrimSpace(b.FirstName) + " " + strings.TrimSpace(b.LastName))
+		buddies[b.ID] = Buddy{Name: name, Email: strings.TrimSpace(b.Email)}
+	}
+
+	sites := make(map[string]string, len(doc.Sites))
+	for _, s := range doc.Sites {
+		sites[s.ID] = strings.TrimSpace(s.Name)
+	}
+
+	dives := []*Dive{}
+	for _, group := range doc.Repetitions {
+		for _, xd := range group.Dives {
+			dives = append(dives, readDive(xd, buddies, sites, loc))
+		}
+	}
+
+	if len(dives) == 0 {
+		return nil, ErrNoDives
+	}
+
+	return dives, nil
+}
+
+// readDive converts a dive from the XML document into a Dive, resolving its
+// links to buddies and sites. Any missing summary values are worked out from
+// the samples.
+func readDive(xd xmlDive, buddies map[string]Buddy, sites map[string]string, loc *time.Location) *Dive {
+	dive := &Dive{ID: xd.ID}
+
+	for _, link := range xd.Links {
+		if buddy, ok := buddies[link.Ref]; ok {
+			dive.Buddies = append(dive.Buddies, buddy)
+		} else if site, ok := sites[link.Ref]; ok {
+			dive.Site = site
+		}
+	}
+
+	startedAt, err := parseDatetime(xd.Datetime, loc)
+	if err != nil {
+		dive.Err = err
+		return dive
+	}
+	dive.StartedAt = startedAt
+
+	for _, wp := range xd.Waypoints {
+		if wp.DiveTime < 0 || wp.Depth < 0 {
+			dive.Err = fmt.Errorf("uddf: invalid sample at %gs", wp.DiveTime)
+			return dive
+		}
+
+		sample := Sample{
+			Elapsed: time.Duration(wp.DiveTime * float64(time.Second)),
+			Depth:   wp.Depth,
+		}
+		if wp.Temperature != nil {
+			sample.Temperature = kelvinToCelsius(*wp.Temperature)
+		}
+		if wp.Pressure != nil {
+			sample.Pressure = pascalToBar(*wp.Pressure)
+		}
+		// Prefer the partial pressure of oxygen measured by a rebreather's
+		// sensors over that calculated by the dive computer.
+		switch {
+		case wp.PPO2 != nil:
+			sample.PPO2 = pascalToBar(*wp.PPO2)
+		case wp.CalcPPO2 != nil:
+			sample.PPO2 = pascalToBar(*wp.CalcPPO2)
+		}
+
+		dive.Samples = append(dive.Samples, sample)
+		dive.MaxDepth = math.Max(dive.MaxDepth, sample.Depth)
+		dive.Duration = max(dive.Duration, sample.Elapsed)
+		if sample.Temperature != nil && (dive.MinTemperature == nil || *sample.Temperature < *dive.MinTemperature) {
+			dive.MinTemperature = sample.Temperature
+		}
+	}
+
+	// Prefer the summary values recorded by the dive computer over those
+	// worked out from the samples, as the samples may be taken infrequently.
+	if xd.MaxDepth != nil {
+		dive.MaxDepth = *xd.MaxDepth
+	}
+	if xd.Duration != nil {
+		dive.Duration = time.Duration(*xd.Duration * float64(time.Second))
+	}
+	if xd.MinTemp != nil {
+		dive.MinTemperature = kelvinToCelsius(*xd.MinTemp)
+	}
+
+	return dive
+}
+
+// parseDatetime parses the date and time that a dive started in any of the
+// datetimeLayouts, using loc for any without a time zone offset.
+func parseDatetime(s string, loc *time.Location) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, errors.New("uddf: dive has no date and time")
+	}
+
+	for _, layout := range datetimeLayouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("uddf: invalid date and time %q", s)
+}
+
+// kelvinToCelsius converts a temperature in Kelvin to degrees Celsius, rounded
+// to one decimal place.
+func kelvinToCelsius(k float64) *float64 {
+	c := math.Round((k-absoluteZero)*10) / 10
+	return &c
+}
+
+// pascalToBar converts a pressure in Pascal to bar, rounded to two decimal
+// places.
+func pascalToBar(pa float64) *float64 {
+	bar := math.Round(pa/1000) / 100
+	return &bar
+}
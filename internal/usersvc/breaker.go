@@ -0,0 +1,77 @@
+package usersvc
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a simple circuit breaker. After threshold consecutive failures it
+// opens and rejects all calls until cooldown has passed. It then lets a single
+// trial call through; if that succeeds the breaker closes again, otherwise it
+// stays open for another cooldown period.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	trialing  bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may be made. A threshold of zero or less
+// disables the breaker.
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+
+	if time.Now().Before(b.openUntil) || b.trialing {
+		return false
+	}
+
+	b.trialing = true
+	return true
+}
+
+// success records a successful call and closes the breaker.
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.trialing = false
+}
+
+// failure records a failed call, opening the breaker if the threshold has been
+// reached.
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.trialing = false
+
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// release ends a call without recording it as either a success or a failure,
+// for example when the caller gave up before the call completed.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trialing = false
+}
@@ -0,0 +1,70 @@
+package usersvc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker(3, time.Minute)
+
+	// The breaker stays closed until the threshold is reached, and a success
+	// resets the count of consecutive failures.
+	b.failure()
+	b.failure()
+	b.success()
+	b.failure()
+	b.failure()
+	if !b.allow() {
+		t.Fatal("breaker opened before reaching the threshold")
+	}
+
+	b.failure()
+	if b.allow() {
+		t.Fatal("breaker did not open after reaching the threshold")
+	}
+
+	// Once the cooldown has passed, a single trial call is let through.
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("breaker did not allow a trial call after the cooldown")
+	}
+	if b.allow() {
+		t.Fatal("breaker allowed a second call during the trial")
+	}
+
+	// A failed trial opens the breaker for another cooldown.
+	b.failure()
+	if b.allow() {
+		t.Fatal("breaker did not reopen after a failed trial")
+	}
+
+	// A trial that is released lets another trial through.
+	b.openUntil = time.Now().Add(-time.Second)
+	if !b.allow() {
+		t.Fatal("breaker did not allow a trial call after the cooldown")
+	}
+	b.release()
+	if !b.allow() {
+		t.Fatal("breaker did not allow a trial call after the last was released")
+	}
+
+	// A successful trial closes the breaker.
+	b.success()
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatal("breaker did not close after a successful trial")
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := newBreaker(0, time.Minute)
+
+	for i := 0; i < 10; i++ {
+		b.failure()
+	}
+	if !b.allow() {
+		t.Fatal("disabled breaker rejected a call")
+	}
+}
@@ -0,0 +1,102 @@
+package usersvc
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+)
+
+type cacheEntry struct {
+	user    data.User
+	expires time.Time
+}
+
+// queuedKey records when the entry stored under key at the time was due to
+// expire, so that an entry that has since been replaced is not removed early.
+type queuedKey struct {
+	key     string
+	expires time.Time
+}
+
+// cache holds recently looked up users, keyed by both their email address and
+// their user ID, for a fixed time-to-live. As every entry lives for the same
+// time, the keys are queued in the order that they expire. Each time a user is
+// stored, expired entries are removed from the front of the queue, as are the
+// oldest entries if the cache holds more than size of them, so that lookups of
+// many different users cannot grow the cache without bound.
+type cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	size    int
+	entries map[string]cacheEntry
+	queue   *list.List
+}
+
+func newCache(ttl time.Duration, size int) *cache {
+	return &cache{
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]cacheEntry),
+		queue:   list.New(),
+	}
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+func idKey(userID string) string {
+	return "id:" + userID
+}
+
+// get returns a copy of the user stored under key if it has not expired.
+func (c *cache) get(key string) (*data.User, bool) {
+	if c.ttl <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	user := entry.user
+	return &user, true
+}
+
+// set stores a copy of the given user under both its email and ID keys, and
+// then removes any expired entries and the oldest entries over the size limit.
+func (c *cache) set(user *data.User) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entry := cacheEntry{user: *user, expires: now.Add(c.ttl)}
+
+	for _, key := range []string{emailKey(user.Email), idKey(user.UserID)} {
+		c.entries[key] = entry
+		c.queue.PushBack(queuedKey{key: key, expires: entry.expires})
+	}
+
+	for e := c.queue.Front(); e != nil; e = c.queue.Front() {
+		queued := e.Value.(queuedKey)
+		if len(c.entries) <= c.size && now.Before(queued.expires) {
+			break
+		}
+
+		c.queue.Remove(e)
+		if entry, ok := c.entries[queued.key]; ok && entry.expires.Equal(queued.expires) {
+			delete(c.entries, queued.key)
+		}
+	}
+}
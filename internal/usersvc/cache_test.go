@@ -0,0 +1,107 @@
+package usersvc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+)
+
+func TestCache(t *testing.T) {
+	c := newCache(time.Minute, 10)
+	c.set(&data.User{UserID: "u1", Email: "Diver@Example.com", Name: "Diver"})
+
+	for _, key := range []string{idKey("u1"), emailKey("diver@example.com"), emailKey("DIVER@EXAMPLE.COM")} {
+		user, ok := c.get(key)
+		if !ok {
+			t.Fatalf("no user cached under %q", key)
+		}
+		if user.UserID != "u1" {
+			t.Errorf("got user %q under %q, want u1", user.UserID, key)
+		}
+	}
+
+	if _, ok := c.get(idKey("u2")); ok {
+		t.Error("got a user for an ID that was never cached")
+	}
+
+	// Changes to a returned user must not change the cached copy.
+	user, _ := c.get(idKey("u1"))
+	user.Name = "Changed"
+	if user, _ := c.get(idKey("u1")); user.Name != "Diver" {
+		t.Errorf("got cached name %q, want Diver", user.Name)
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	c := newCache(time.Minute, 10)
+	c.set(&data.User{UserID: "u1", Email: "diver@example.com"})
+
+	// Expire the user's entries, both in the map and in the queue.
+	expired := time.Now().Add(-time.Second)
+	for _, key := range []string{idKey("u1"), emailKey("diver@example.com")} {
+		entry := c.entries[key]
+		entry.expires = expired
+		c.entries[key] = entry
+	}
+	for e := c.queue.Front(); e != nil; e = e.Next() {
+		e.Value = queuedKey{key: e.Value.(queuedKey).key, expires: expired}
+	}
+
+	if _, ok := c.get(idKey("u1")); ok {
+		t.Fatal("got an expired user")
+	}
+
+	// Expired entries are removed when the next user is stored.
+	c.set(&data.User{UserID: "u2", Email: "buddy@example.com"})
+	if len(c.entries) != 2 || c.queue.Len() != 2 {
+		t.Errorf("got %d entries and %d queued keys, want 2 of each", len(c.entries), c.queue.Len())
+	}
+	if _, ok := c.get(idKey("u2")); !ok {
+		t.Error("new user was not cached")
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	c := newCache(time.Minute, 4)
+
+	users := []data.User{
+		{UserID: "u1", Email: "diver@example.com"},
+		{UserID: "u2", Email: "buddy@example.com"},
+		{UserID: "u3", Email: "other@example.com"},
+	}
+	for i := range users {
+		c.set(&users[i])
+	}
+
+	if len(c.entries) != 4 {
+		t.Fatalf("got %d entries, want 4", len(c.entries))
+	}
+	if _, ok := c.get(idKey("u1")); ok {
+		t.Error("oldest user was not evicted")
+	}
+	for _, key := range []string{idKey("u2"), emailKey("other@example.com")} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("no user cached under %q", key)
+		}
+	}
+
+	// Storing a user again replaces their entries rather than adding to them,
+	// and their earlier place in the queue no longer evicts them.
+	c.set(&users[1])
+	c.set(&users[2])
+	for _, key := range []string{idKey("u2"), idKey("u3")} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("no user cached under %q", key)
+		}
+	}
+}
+
+func TestCacheDisabled(t *testing.T) {
+	c := newCache(0, 10)
+	c.set(&data.User{UserID: "u1", Email: "diver@example.com"})
+
+	if _, ok := c.get(idKey("u1")); ok {
+		t.Fatal("disabled cache returned a user")
+	}
+}
@@ -0,0 +1,114 @@
+package usersvc
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+)
+
+var _ Client = (*Fake)(nil)
+
+// Fake is an in-process Client backed by a map of users. It is intended for
+// running handlers without a live User service, for example in tests or local
+// development. The zero value is not usable; create one with NewFake.
+type Fake struct {
+	mu     sync.RWMutex
+	users  map[string]data.User
+	tokens map[string]string
+
+	// Err, if set, is returned by every lookup instead of a user.
+	Err error
+}
+
+// NewFake returns a new Fake containing the given users.
+func NewFake(users ...data.User) *Fake {
+	f := &Fake{users: make(map[string]data.User), tokens: make(map[string]string)}
+	for _, user := range users {
+		f.Add(user)
+	}
+
+	return f
+}
+
+// Add adds the given user to the Fake, replacing any existing user with the
+// same user ID.
+func (f *Fake) Add(user data.User) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.users[user.UserID] = user
+}
+
+// AddToken makes the given authentication token valid for the user with the
+// given user ID.
+func (f *Fake) AddToken(token, userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tokens[token] = userID
+}
+
+// Remove removes the user with the given user ID from the Fake, as if their
+// account had been deleted or suspended.
+func (f *Fake) Remove(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.users, userID)
+}
+
+// GetByEmail returns the user with the given email address, compared case
+// insensitively.
+func (f *Fake) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	for _, user := range f.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// GetByID returns the user with the given user ID.
+func (f *Fake) GetByID(ctx context.Context, userID string) (*data.User, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	user, ok := f.users[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &user, nil
+}
+
+// GetByToken returns the user that the given authentication token was added
+// for.
+func (f *Fake) GetByToken(ctx context.Context, token string) (*data.User, error) {
+	if f.Err != nil {
+		return nil, f.Err
+	}
+
+	f.mu.RLock()
+	userID, ok := f.tokens[token]
+	f.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	return f.GetByID(ctx, userID)
+}
@@ -0,0 +1,192 @@
+package usersvc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+	"github.com/m5lapp/go-service-toolkit/serialisation/jsonz"
+	"golang.org/x/exp/slog"
+)
+
+var _ Client = (*HTTPClient)(nil)
+
+// jSendResponse is a JSend response from the User service with its Data field
+// left undecoded until the Status is known.
+type jSendResponse struct {
+	Status  string          `json:"status"`
+	Data    json.RawMessage `json:"data"`
+	Message string          `json:"message"`
+}
+
+// HTTPClient is a Client that calls the User service over HTTP. Failed requests
+// are retried with exponential backoff, repeated failures trip a circuit
+// breaker so that a struggling User service is not overwhelmed, and successful
+// lookups are cached.
+type HTTPClient struct {
+	addr    string
+	cfg     Config
+	http    *http.Client
+	breaker *breaker
+	cache   *cache
+	logger  *slog.Logger
+}
+
+// NewHTTPClient returns a new HTTPClient for the User service at the given
+// address, or an error if the given Config is not valid.
+func NewHTTPClient(addr string, cfg Config, logger *slog.Logger) (*HTTPClient, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &HTTPClient{
+		addr:    addr,
+		cfg:     cfg,
+		http:    &http.Client{},
+		breaker: newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+		cache:   newCache(cfg.CacheTTL, cfg.CacheSize),
+		logger:  logger,
+	}, nil
+}
+
+// GetByEmail looks up the active user account with the given email address.
+func (c *HTTPClient) GetByEmail(ctx context.Context, email string) (*data.User, error) {
+	return c.get(ctx, "/v1/user/email/"+url.PathEscape(email), emailKey(email), "")
+}
+
+// GetByID looks up the active user account with the given user ID.
+func (c *HTTPClient) GetByID(ctx context.Context, userID string) (*data.User, error) {
+	return c.get(ctx, "/v1/user/id/"+url.PathEscape(userID), idKey(userID), "")
+}
+
+// GetByToken looks up the active user account that the given authentication
+// token was issued to by passing it on to the User service. Lookups by token
+// are never served from the cache so that revoked tokens stop working
+// immediately.
+func (c *HTTPClient) GetByToken(ctx context.Context, token string) (*data.User, error) {
+	return c.get(ctx, "/v1/user/me", "", token)
+}
+
+// get returns the user from the cache under cacheKey if possible, otherwise it
+// requests it from the given path of the User service, retrying as configured.
+// An empty cacheKey skips the cache lookup. If token is not empty, it is sent
+// as a bearer token with each request.
+func (c *HTTPClient) get(ctx context.Context, path, cacheKey, token string) (*data.User, error) {
+	if cacheKey != "" {
+		if user, ok := c.cache.get(cacheKey); ok {
+			return user, nil
+		}
+	}
+
+	if !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	var user *data.User
+	var err error
+	var retry bool
+
+	backoff := c.cfg.RetryBackoff
+	for attempt := 0; attempt <= c.cfg.Retries; attempt++ {
+		if attempt > 0 {
+			c.logger.Warn("Retrying user service request", "path", path,
+				"attempt", attempt, "error", err.Error())
+
+			// Add up to 50% jitter so that retries from concurrent requests
+			// do not all arrive at the same time.
+			wait := backoff + time.Duration(rand.Int63n(int64(backoff)/2+1))
+			select {
+			case <-ctx.Done():
+				c.breaker.release()
+				return nil, ctx.Err()
+			case <-time.After(wait):
+			}
+			backoff *= 2
+		}
+
+		user, retry, err = c.do(ctx, path, token)
+		if !retry {
+			break
+		}
+	}
+
+	// Only failures of the User service itself count towards the breaker. A
+	// user that cannot be found or a rejected request both mean that the User
+	// service is working.
+	switch {
+	case retry:
+		c.breaker.failure()
+	case ctx.Err() != nil:
+		c.breaker.release()
+	default:
+		c.breaker.success()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.cache.set(user)
+	return user, nil
+}
+
+// do makes a single request to the given path of the User service and decodes
+// the JSend response. The returned bool reports whether the request failed in a
+// way that is worth retrying.
+func (c *HTTPClient) do(ctx context.Context, path, token string) (*data.User, bool, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, c.addr+path, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// Don't retry if it was the caller that gave up on the request.
+		return nil, ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+
+	var res jSendResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1_048_576)).Decode(&res)
+	if err != nil {
+		return nil, resp.StatusCode >= 500, fmt.Errorf("decoding user service response: %w", err)
+	}
+
+	switch res.Status {
+	case jsonz.JSendStatusSuccess:
+		userResp := &data.UserResponse{User: data.User{}}
+		err = jsonz.DecodeJSON(bytes.NewReader(res.Data), userResp, true)
+		if err != nil {
+			return nil, false, err
+		}
+		return &userResp.User, false, nil
+	case jsonz.JSendStatusFail:
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, false, ErrNotFound
+		case resp.StatusCode == http.StatusUnauthorized && token != "":
+			return nil, false, ErrInvalidToken
+		}
+		return nil, false, &FailError{StatusCode: resp.StatusCode, Data: res.Data}
+	case jsonz.JSendStatusError:
+		return nil, true, errors.New(res.Message)
+	default:
+		return nil, true, fmt.Errorf("unexpected JSend status %q from user service", res.Status)
+	}
+}
@@ -0,0 +1,208 @@
+package usersvc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// testUserService is a User service that responds to lookups of user u1, by
+// ID, email address or the token "valid", fails with a 503 for user "down" and
+// responds with a 404 for anything else. It counts the requests it receives.
+type testUserService struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newTestUserService(t *testing.T) *testUserService {
+	s := &testUserService{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+
+		switch {
+		case r.URL.Path == "/v1/user/id/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"status":"error","message":"the server is unavailable"}`)
+		case r.URL.Path == "/v1/user/me" && r.Header.Get("Authorization") != "Bearer valid":
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"status":"fail","data":{"error":"invalid token"}}`)
+		case r.URL.Path == "/v1/user/id/u1" || r.URL.Path == "/v1/user/email/diver@example.com" ||
+			r.URL.Path == "/v1/user/me":
+			io.WriteString(w, `{"status":"success","data":{"user":{"user_id":"u1","email":"diver@example.com","name":"Diver"}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"status":"fail","data":{"error":"not found"}}`)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func newTestHTTPClient(t *testing.T, addr string, cfg Config) *HTTPClient {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	c, err := NewHTTPClient(addr, cfg, logger)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return c
+}
+
+var testConfig = Config{
+	Timeout:          time.Second,
+	Retries:          2,
+	RetryBackoff:     time.Millisecond,
+	BreakerThreshold: 0,
+	CacheTTL:         time.Minute,
+	CacheSize:        100,
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	svc := newTestUserService(t)
+	c := newTestHTTPClient(t, svc.URL, testConfig)
+
+	_, err := c.GetByID(context.Background(), "down")
+	if err == nil {
+		t.Fatal("got no error from a failing user service")
+	}
+	if got, want := svc.requests.Load(), int32(testConfig.Retries+1); got != want {
+		t.Errorf("got %d requests, want %d", got, want)
+	}
+}
+
+func TestHTTPClientNoRetries(t *testing.T) {
+	tests := []struct {
+		name   string
+		lookup func(c *HTTPClient) error
+		err    error
+	}{
+		{"not found", func(c *HTTPClient) error {
+			_, err := c.GetByID(context.Background(), "missing")
+			return err
+		}, ErrNotFound},
+		{"invalid token", func(c *HTTPClient) error {
+			_, err := c.GetByToken(context.Background(), "invalid")
+			return err
+		}, ErrInvalidToken},
+		{"found", func(c *HTTPClient) error {
+			user, err := c.GetByID(context.Background(), "u1")
+			if err == nil && user.Email != "diver@example.com" {
+				t.Errorf("got email %q, want diver@example.com", user.Email)
+			}
+			return err
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := newTestUserService(t)
+			c := newTestHTTPClient(t, svc.URL, testConfig)
+
+			err := tt.lookup(c)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			if got := svc.requests.Load(); got != 1 {
+				t.Errorf("got %d requests, want 1", got)
+			}
+		})
+	}
+}
+
+func TestHTTPClientCache(t *testing.T) {
+	svc := newTestUserService(t)
+	c := newTestHTTPClient(t, svc.URL, testConfig)
+	ctx := context.Background()
+
+	// A lookup by ID also caches the user under their email address.
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetByID(ctx, "u1"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, err := c.GetByEmail(ctx, "Diver@Example.com"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := svc.requests.Load(); got != 1 {
+		t.Errorf("got %d requests, want 1", got)
+	}
+
+	// Lookups by token are never cached.
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetByToken(ctx, "valid"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := svc.requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestHTTPClientBreaker(t *testing.T) {
+	svc := newTestUserService(t)
+
+	cfg := testConfig
+	cfg.Retries = 0
+	cfg.BreakerThreshold = 2
+	cfg.BreakerCooldown = time.Minute
+	c := newTestHTTPClient(t, svc.URL, cfg)
+	ctx := context.Background()
+
+	// Users that cannot be found do not count as failures.
+	if _, err := c.GetByID(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, ErrNotFound)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetByID(ctx, "down"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("got error %v, want a user service error", err)
+		}
+	}
+
+	if _, err := c.GetByID(ctx, "u1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got error %v, want %v", err, ErrCircuitOpen)
+	}
+	if got := svc.requests.Load(); got != 3 {
+		t.Errorf("got %d requests, want 3", got)
+	}
+}
+
+func TestNewHTTPClientConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   func(c *Config)
+		valid bool
+	}{
+		{"defaults", func(c *Config) {}, true},
+		{"no retries", func(c *Config) { c.Retries = 0 }, true},
+		{"negative retries", func(c *Config) { c.Retries = -1 }, false},
+		{"zero timeout", func(c *Config) { c.Timeout = 0 }, false},
+		{"zero retry backoff", func(c *Config) { c.RetryBackoff = 0 }, false},
+		{"negative retry backoff", func(c *Config) { c.RetryBackoff = -time.Second }, false},
+		{"negative breaker cooldown", func(c *Config) { c.BreakerCooldown = -time.Second }, false},
+		{"cache too small", func(c *Config) { c.CacheSize = 1 }, false},
+		{"no cache", func(c *Config) { c.CacheTTL, c.CacheSize = 0, 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			tt.cfg(&cfg)
+
+			_, err := NewHTTPClient("http://localhost", cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if valid := err == nil; valid != tt.valid {
+				t.Errorf("got error %v, want valid to be %t", err, tt.valid)
+			}
+		})
+	}
+}
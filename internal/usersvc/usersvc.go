@@ -0,0 +1,90 @@
+// Package usersvc provides clients for looking up users in the User service,
+// which owns the base details of every user account that a Diver is built on.
+package usersvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/m5lapp/go-dive-diver-service/internal/data"
+)
+
+var (
+	ErrCircuitOpen  = errors.New("user service circuit breaker is open")
+	ErrInvalidToken = errors.New("invalid or expired authentication token")
+	ErrNotFound     = errors.New("user not found")
+)
+
+// FailError is returned when the User service rejects a request with a JSend
+// fail response other than a 404. The status code and data of the response are
+// kept so that they can be passed on to the client.
+type FailError struct {
+	StatusCode int
+	Data       json.RawMessage
+}
+
+func (e *FailError) Error() string {
+	return fmt.Sprintf("user service request failed with status %d", e.StatusCode)
+}
+
+// Client looks up active user accounts in the User service. If no active
+// account exists for the given email address or user ID, ErrNotFound is
+// returned. If the User service does not accept the given authentication
+// token, ErrInvalidToken is returned.
+type Client interface {
+	GetByEmail(ctx context.Context, email string) (*data.User, error)
+	GetByID(ctx context.Context, userID string) (*data.User, error)
+	GetByToken(ctx context.Context, token string) (*data.User, error)
+}
+
+// Config stores the settings that control how an HTTPClient talks to the User
+// service.
+type Config struct {
+	Timeout          time.Duration
+	Retries          int
+	RetryBackoff     time.Duration
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	CacheTTL         time.Duration
+	CacheSize        int
+}
+
+// Flags parses the flags for the User service client.
+func (c *Config) Flags() {
+	flag.DurationVar(&c.Timeout, "user-service-timeout", 2*time.Second,
+		"Timeout for each request to the user service (time.Duration)")
+	flag.IntVar(&c.Retries, "user-service-retries", 2,
+		"Number of times to retry a failed request to the user service")
+	flag.DurationVar(&c.RetryBackoff, "user-service-retry-backoff", 100*time.Millisecond,
+		"Initial backoff between user service retries, doubled each time (time.Duration)")
+	flag.IntVar(&c.BreakerThreshold, "user-service-breaker-threshold", 5,
+		"Consecutive user service failures before the circuit breaker opens")
+	flag.DurationVar(&c.BreakerCooldown, "user-service-breaker-cooldown", 30*time.Second,
+		"How long the user service circuit breaker stays open (time.Duration)")
+	flag.DurationVar(&c.CacheTTL, "user-service-cache-ttl", time.Minute,
+		"How long user service lookups are cached for, 0 to disable (time.Duration)")
+	flag.IntVar(&c.CacheSize, "user-service-cache-size", 10000,
+		"Maximum number of user service cache entries, two per user")
+}
+
+// validate checks that the settings in the Config can be used.
+func (c Config) validate() error {
+	switch {
+	case c.Timeout <= 0:
+		return errors.New("user service timeout must be greater than zero")
+	case c.Retries < 0:
+		return errors.New("user service retries must not be negative")
+	case c.RetryBackoff <= 0:
+		return errors.New("user service retry backoff must be greater than zero")
+	case c.BreakerCooldown < 0:
+		return errors.New("user service breaker cooldown must not be negative")
+	case c.CacheTTL > 0 && c.CacheSize < 2:
+		return errors.New("user service cache size must be at least two")
+	}
+
+	return nil
+}
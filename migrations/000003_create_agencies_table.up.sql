@@ -3,7 +3,7 @@ create table if not exists agencies (
     common_name text not null unique,
     full_name   text not null unique,
     acronym     text,
-    url         text,
+    url         text
 );
 
 create table if not exists agency_courses (
@@ -0,0 +1,3 @@
+drop index if exists certifications_user_id_idx;
+
+drop table if exists certifications;
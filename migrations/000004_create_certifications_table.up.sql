@@ -0,0 +1,16 @@
+create table if not exists certifications (
+    id          bigint primary key generated always as identity,
+    version     integer not null default 1,
+    created_at  timestamp(8) with time zone not null default now(),
+    updated_at  timestamp(8) with time zone not null default now(),
+    user_id     text    not null references divers(user_id) on delete cascade,
+    course_id   bigint  not null references agency_courses(id) on delete restrict,
+    cert_number text,
+    issue_date  date    not null,
+    instructor  text,
+    dive_centre text,
+    unique(user_id, course_id)
+);
+
+create index if not exists certifications_user_id_idx
+    on certifications (user_id);
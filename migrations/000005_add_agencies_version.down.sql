@@ -0,0 +1,2 @@
+alter table agencies
+    drop column if exists version;
@@ -0,0 +1,2 @@
+alter table agencies
+    add column if not exists version integer not null default 1;
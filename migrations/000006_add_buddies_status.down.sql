@@ -0,0 +1,4 @@
+drop index if exists buddies_buddy_user_id_status_idx;
+
+alter table buddies
+    drop column if exists status;
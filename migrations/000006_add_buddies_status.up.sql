@@ -0,0 +1,13 @@
+alter table buddies
+    add column if not exists status text
+        check (status in ('pending', 'accepted', 'declined', 'blocked'));
+
+-- Existing linked buddies were created without the other diver's consent, so
+-- treat them as outstanding requests.
+update buddies
+   set status = 'pending'
+ where buddy_user_id is not null
+   and status is null;
+
+create index if not exists buddies_buddy_user_id_status_idx
+    on buddies (buddy_user_id, status);
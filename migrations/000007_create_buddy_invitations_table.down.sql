@@ -0,0 +1,3 @@
+drop index if exists buddy_invitations_buddy_id_idx;
+
+drop table if exists buddy_invitations;
@@ -0,0 +1,10 @@
+create table if not exists buddy_invitations (
+    hash     bytea  primary key,
+    buddy_id bigint not null references buddies(id) on delete cascade,
+    user_id  text   not null check (length(user_id) = 20),
+    email    citext not null,
+    expiry   timestamp(0) with time zone not null
+);
+
+create index if not exists buddy_invitations_buddy_id_idx
+    on buddy_invitations (buddy_id);
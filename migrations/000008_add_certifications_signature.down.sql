@@ -0,0 +1,3 @@
+alter table certifications
+    drop column if exists signed_at,
+    drop column if exists signed_by;
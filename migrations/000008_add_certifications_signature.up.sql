@@ -0,0 +1,3 @@
+alter table certifications
+    add column if not exists signed_by text check (length(signed_by) = 20),
+    add column if not exists signed_at timestamp(8) with time zone;
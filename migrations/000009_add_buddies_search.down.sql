@@ -0,0 +1,10 @@
+drop index if exists buddies_search_idx;
+
+alter table buddies
+    drop column if exists search;
+
+create index if not exists buddies_user_id_idx
+    on buddies using gin (to_tsvector('simple', user_id));
+
+create index if not exists divers_user_id_idx
+    on divers using gin (to_tsvector('simple', user_id));
@@ -0,0 +1,19 @@
+-- Full-text indexes on the user IDs are never used, as user IDs are only ever
+-- matched exactly and are already covered by the primary and unique keys.
+drop index if exists divers_user_id_idx;
+drop index if exists buddies_user_id_idx;
+
+-- Email addresses are indexed both whole and split into their parts so that a
+-- search for the start of the local part or domain also finds them.
+alter table buddies
+    add column if not exists search tsvector generated always as (
+        setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+        setweight(to_tsvector('simple', coalesce(email, '') || ' ' ||
+                  translate(coalesce(email, ''), '@.+_-', '     ')), 'B') ||
+        setweight(to_tsvector('simple', coalesce(organisation, '') || ' ' ||
+                  coalesce(org_member_id, '')), 'C') ||
+        setweight(to_tsvector('simple', coalesce(notes, '')), 'D')
+    ) stored;
+
+create index if not exists buddies_search_idx
+    on buddies using gin (search);
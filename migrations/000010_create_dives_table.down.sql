@@ -0,0 +1,3 @@
+drop table if exists dive_buddies;
+
+drop table if exists dives;
@@ -0,0 +1,24 @@
+create table if not exists dives (
+    id          bigint primary key generated always as identity,
+    version     integer not null default 1,
+    created_at  timestamp(8) with time zone not null default now(),
+    updated_at  timestamp(8) with time zone not null default now(),
+    user_id     text    not null references divers(user_id) on delete cascade,
+    started_at  timestamp(8) with time zone not null,
+    site        text,
+    max_depth   numeric(5, 2) not null check (max_depth > 0),
+    bottom_time integer not null check (bottom_time > 0),
+    water_temp  numeric(3, 1)
+);
+
+create index if not exists dives_user_id_started_at_idx
+    on dives (user_id, started_at, id);
+
+create table if not exists dive_buddies (
+    dive_id  bigint not null references dives(id) on delete cascade,
+    buddy_id bigint not null references buddies(id) on delete cascade,
+    primary key (dive_id, buddy_id)
+);
+
+create index if not exists dive_buddies_buddy_id_idx
+    on dive_buddies (buddy_id);
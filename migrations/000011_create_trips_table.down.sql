@@ -0,0 +1,8 @@
+drop index if exists dives_trip_id_idx;
+
+alter table dives
+    drop column if exists trip_id;
+
+drop table if exists trip_participants;
+
+drop table if exists trips;
@@ -0,0 +1,32 @@
+create table if not exists trips (
+    id         bigint primary key generated always as identity,
+    version    integer not null default 1,
+    created_at timestamp(8) with time zone not null default now(),
+    updated_at timestamp(8) with time zone not null default now(),
+    user_id    text not null references divers(user_id) on delete cascade,
+    name       text not null,
+    start_date date not null,
+    end_date   date not null,
+    country    text,
+    time_zone  text,
+    itinerary  text,
+    check (end_date >= start_date)
+);
+
+create index if not exists trips_user_id_end_date_idx
+    on trips (user_id, end_date);
+
+create table if not exists trip_participants (
+    trip_id  bigint not null references trips(id) on delete cascade,
+    buddy_id bigint not null references buddies(id) on delete cascade,
+    primary key (trip_id, buddy_id)
+);
+
+create index if not exists trip_participants_buddy_id_idx
+    on trip_participants (buddy_id);
+
+alter table dives
+    add column if not exists trip_id bigint references trips(id) on delete set null;
+
+create index if not exists dives_trip_id_idx
+    on dives (trip_id);
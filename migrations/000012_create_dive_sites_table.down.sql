@@ -0,0 +1,8 @@
+drop table if exists trip_sites;
+
+drop index if exists dives_site_id_idx;
+
+alter table dives
+    drop column if exists site_id;
+
+drop table if exists dive_sites;
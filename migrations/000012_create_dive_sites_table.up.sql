@@ -0,0 +1,43 @@
+create table if not exists dive_sites (
+    id          bigint primary key generated always as identity,
+    version     integer not null default 1,
+    created_at  timestamp(8) with time zone not null default now(),
+    updated_at  timestamp(8) with time zone not null default now(),
+    created_by  text references divers(user_id) on delete set null,
+    name        text not null,
+    country     text not null,
+    region      text,
+    latitude    double precision not null check (latitude between -90 and 90),
+    longitude   double precision not null check (longitude between -180 and 180),
+    max_depth   numeric(5, 2) check (max_depth > 0),
+    entry_type  text check (entry_type in ('shore', 'boat', 'pier')),
+    description text,
+    search      tsvector generated always as (
+        setweight(to_tsvector('simple', name), 'A') ||
+        setweight(to_tsvector('simple', coalesce(region, '')), 'B')
+    ) stored,
+    unique (country, name)
+);
+
+create index if not exists dive_sites_search_idx
+    on dive_sites using gin (search);
+
+-- Proximity searches first narrow the sites down to a band of latitudes around
+-- the point before working out the exact distances.
+create index if not exists dive_sites_latitude_idx
+    on dive_sites (latitude);
+
+alter table dives
+    add column if not exists site_id bigint references dive_sites(id);
+
+create index if not exists dives_site_id_idx
+    on dives (site_id);
+
+create table if not exists trip_sites (
+    trip_id bigint not null references trips(id) on delete cascade,
+    site_id bigint not null references dive_sites(id),
+    primary key (trip_id, site_id)
+);
+
+create index if not exists trip_sites_site_id_idx
+    on trip_sites (site_id);
@@ -0,0 +1,7 @@
+create table if not exists dive_samples (
+    dive_id     bigint  not null references dives(id) on delete cascade,
+    elapsed     integer not null check (elapsed >= 0),
+    depth       numeric(5, 2) not null check (depth >= 0),
+    temperature numeric(3, 1),
+    primary key (dive_id, elapsed)
+);
@@ -0,0 +1,13 @@
+create table if not exists dive_cylinders (
+    dive_id        bigint   not null references dives(id) on delete cascade,
+    position       smallint not null check (position >= 0),
+    description    text,
+    size           numeric(4, 1) check (size > 0),
+    work_pressure  numeric(4, 0) check (work_pressure > 0),
+    start_pressure numeric(4, 0) check (start_pressure >= 0),
+    end_pressure   numeric(4, 0) check (end_pressure >= 0),
+    o2             numeric(4, 1) not null default 21 check (o2 between 0 and 100),
+    he             numeric(4, 1) not null default 0 check (he between 0 and 100),
+    primary key (dive_id, position),
+    check (o2 + he <= 100)
+);
@@ -0,0 +1 @@
+drop table if exists dive_profiles;
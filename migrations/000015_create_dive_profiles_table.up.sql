@@ -0,0 +1,14 @@
+-- Profiles are stored encoded by the profile package rather than a row per
+-- sample. The dive_samples table is no longer written to, but is kept so that
+-- the profiles of dives imported before this change can still be read.
+create table if not exists dive_profiles (
+    dive_id           bigint  primary key references dives(id) on delete cascade,
+    samples           bytea   not null,
+    sample_count      integer not null check (sample_count > 0),
+    duration          integer not null check (duration >= 0),
+    max_depth         numeric(5, 2) not null check (max_depth >= 0),
+    avg_depth         numeric(5, 2) not null check (avg_depth >= 0),
+    max_ascent_rate   numeric(5, 1) not null,
+    ascent_violations integer not null check (ascent_violations >= 0),
+    updated_at        timestamp(8) with time zone not null default now()
+);
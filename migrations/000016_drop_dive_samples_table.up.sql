@@ -0,0 +1,126 @@
+-- Dives imported before 000015 still have their profiles stored a row per
+-- sample in dive_samples. Move them into dive_profiles so that the table can be
+-- dropped, encoding and summarising them in the same way as profile.Encode and
+-- profile.Summarise do. The legacy samples only ever had a depth and an
+-- optional temperature.
+create function pg_temp.uvarint(v bigint) returns bytea as $$
+declare
+    buf bytea := '';
+begin
+    while v >= 128 loop
+        buf := buf || set_byte('\x00'::bytea, 0, ((v & 127) | 128)::integer);
+        v := v >> 7;
+    end loop;
+
+    return buf || set_byte('\x00'::bytea, 0, v::integer);
+end;
+$$ language plpgsql;
+
+-- Signed values are zig-zag encoded first, as by encoding/binary.AppendVarint.
+create function pg_temp.varint(v bigint) returns bytea as $$
+    select pg_temp.uvarint((v << 1) # (v >> 63));
+$$ language sql;
+
+do $$
+declare
+    p              record;
+    n              integer;
+    buf            bytea;
+    prev_elapsed   integer;
+    prev_depth     bigint;
+    prev_temp      bigint;
+    v              bigint;
+    max_depth      numeric;
+    area           numeric;
+    duration       integer;
+    rate           numeric;
+    max_rate       numeric;
+    violations     integer;
+    violating      boolean;
+begin
+    if to_regclass('dive_samples') is null then
+        return;
+    end if;
+
+    for p in
+        select dive_id,
+               array_agg(elapsed order by elapsed) as elapsed,
+               array_agg(depth order by elapsed) as depth,
+               array_agg(temperature order by elapsed) as temperature
+          from dive_samples
+         where dive_id not in (select dive_id from dive_profiles)
+      group by dive_id
+    loop
+        n := array_length(p.elapsed, 1);
+        buf := '\x01'::bytea || pg_temp.uvarint(n);
+        prev_elapsed := 0;
+        prev_depth := 0;
+        prev_temp := 0;
+
+        max_depth := 0;
+        area := 0;
+        max_rate := 0;
+        violations := 0;
+        violating := false;
+
+        for i in 1..n loop
+            buf := buf || set_byte('\x00'::bytea, 0,
+                case when p.temperature[i] is null then 0 else 1 end);
+
+            buf := buf || pg_temp.uvarint(p.elapsed[i] - prev_elapsed);
+            prev_elapsed := p.elapsed[i];
+
+            v := round(p.depth[i] * 100);
+            buf := buf || pg_temp.varint(v - prev_depth);
+            prev_depth := v;
+
+            if p.temperature[i] is not null then
+                v := round(p.temperature[i] * 10);
+                buf := buf || pg_temp.varint(v - prev_temp);
+                prev_temp := v;
+            end if;
+
+            max_depth := greatest(max_depth, p.depth[i]);
+
+            continue when i = 1;
+
+            area := area + (p.elapsed[i] - p.elapsed[i - 1]) *
+                           (p.depth[i] + p.depth[i - 1]) / 2;
+
+            -- The ascent rate is measured from the latest sample at least 30
+            -- seconds earlier, and each continuous period of ascending faster
+            -- than 10 m/min counts as one violation.
+            rate := null;
+            for j in reverse i - 1..1 loop
+                if p.elapsed[i] - p.elapsed[j] >= 30 then
+                    rate := (p.depth[j] - p.depth[i]) /
+                            (p.elapsed[i] - p.elapsed[j]) * 60;
+                    exit;
+                end if;
+            end loop;
+
+            continue when rate is null;
+
+            max_rate := greatest(max_rate, rate);
+            if rate > 10 and not violating then
+                violations := violations + 1;
+            end if;
+            violating := rate > 10;
+        end loop;
+
+        duration := p.elapsed[n] - p.elapsed[1];
+
+        insert into dive_profiles (
+            dive_id, samples, sample_count, duration, max_depth, avg_depth,
+            max_ascent_rate, ascent_violations
+        )
+        values (
+            p.dive_id, buf, n, duration, max_depth,
+            case when duration > 0 then round(area / duration, 2) else 0 end,
+            round(max_rate, 1), violations
+        );
+    end loop;
+end;
+$$;
+
+drop table if exists dive_samples;
@@ -0,0 +1,2 @@
+alter table certifications
+    drop column if exists instructor_user_id;
@@ -0,0 +1,2 @@
+alter table certifications
+    add column if not exists instructor_user_id text check (length(instructor_user_id) = 20);